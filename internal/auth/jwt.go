@@ -1,11 +1,10 @@
 package auth
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,49 +14,79 @@ import (
 
 const tokenIssuer string = "chirpy"
 
-// MakeJWT generates a signed JWT for a given user ID using the provided secret key.
-// Returns the signed token string or an error if signing fails.
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	signingKey := []byte(tokenSecret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
-	})
+// Claims are the validated contents of an access token.
+type Claims struct {
+	// UserID is the user the token was issued to.
+	UserID uuid.UUID
+	// Scopes are the permissions granted by the token.
+	Scopes []string
+	// ExpiresAt is when the token stops being valid.
+	ExpiresAt time.Time
+}
 
-	return token.SignedString(signingKey)
+// HasScopes reports whether the token grants every given scope.
+func (c Claims) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenClaims is the JWT payload. Scope is a pointer to tell tokens issued before scopes
+// were introduced, which carry no claim at all, from tokens granting no scopes.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scope *string `json:"scope,omitempty"`
+}
+
+// MakeJWT generates a JWT for a given user ID granting the given scopes, signed with the signing key of the key set.
+// Returns the signed token string or an error if signing fails.
+func MakeJWT(userID uuid.UUID, scopes []string, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return MakeJWTExpiringAt(userID, scopes, keys, time.Now().UTC().Add(expiresIn))
 }
 
-// ValidateJWT parses and validates a JWT string using the provided secret.
-// Returns the parsed user ID or an error if validation fails.
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
-		return []byte(tokenSecret), nil
+// MakeJWTExpiringAt is like MakeJWT, but takes the time the token expires at instead of its lifetime,
+// for callers reporting the expiration alongside the token. The time is truncated to whole seconds.
+func MakeJWTExpiringAt(userID uuid.UUID, scopes []string, keys *KeySet, expiresAt time.Time) (string, error) {
+	scope := formatScope(scopes)
+	return keys.sign(tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			Subject:   userID.String(),
+		},
+		Scope: &scope,
 	})
-	if err != nil {
-		return uuid.Nil, err
-	}
+}
 
-	userID, err := token.Claims.GetSubject()
+// ValidateJWT parses and validates a JWT string using the key set, picking the key by the "kid" header.
+// Returns the claims of the token or an error if validation fails.
+func ValidateJWT(tokenString string, keys *KeySet) (Claims, error) {
+	claims := &tokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keys.keyfunc, jwt.WithIssuer(tokenIssuer), jwt.WithExpirationRequired())
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, err
 	}
 
-	issuer, err := token.Claims.GetIssuer()
+	userID, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.Nil, err
-	}
-	if issuer != tokenIssuer {
-		return uuid.Nil, errors.New("invalid issuer")
+		return Claims{}, fmt.Errorf("invalid user ID: %w", err)
 	}
 
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+	// tokens issued before scopes were introduced granted full access
+	scopes := AllScopes
+	if claims.Scope != nil {
+		scopes = parseScope(*claims.Scope)
 	}
 
-	return userUUID, nil
+	return Claims{
+		UserID:    userID,
+		Scopes:    scopes,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
 }
 
 // extractAuthToken extracts a token for the given scheme from the HTTP Authorization header.
@@ -91,11 +120,5 @@ func GetApiKey(headers http.Header) (string, error) {
 // MakeRefreshToken generates a new secure random refresh token.
 // Returns the token or an error if random data generation fails.
 func MakeRefreshToken() (string, error) {
-	key := make([]byte, 32)
-	_, err := rand.Read(key)
-	if err != nil {
-		return "", err
-	}
-
-	return hex.EncodeToString(key), nil
+	return MakeOpaqueToken()
 }
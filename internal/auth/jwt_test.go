@@ -19,7 +19,7 @@ func TestMakeJWT(t *testing.T) {
 	expiresIn := time.Hour
 
 	// Generate JWT
-	token, err := auth.MakeJWT(userID, tokenSecret, expiresIn)
+	token, err := auth.MakeJWT(userID, auth.AllScopes, mustHMACKeySet(t, tokenSecret), expiresIn)
 	assert.NoError(t, err, "error should not occur when generating a valid JWT")
 	assert.NotEmpty(t, token, "token should not be empty")
 
@@ -43,7 +43,7 @@ func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
 	expiresIn := time.Hour
 
-	validToken, err := auth.MakeJWT(userID, tokenSecret, expiresIn)
+	validToken, err := auth.MakeJWT(userID, auth.AllScopes, mustHMACKeySet(t, tokenSecret), expiresIn)
 	assert.NoError(t, err, "error should not occur when generating a valid JWT")
 
 	scenarios := []struct {
@@ -78,11 +78,11 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, scenario := range scenarios {
 		t.Run(scenario.name, func(t *testing.T) {
-			parsedUserID, err := auth.ValidateJWT(scenario.token, scenario.tokenSecret)
+			claims, err := auth.ValidateJWT(scenario.token, mustHMACKeySet(t, scenario.tokenSecret))
 
 			if scenario.expectedError == nil {
 				assert.NoError(t, err, "error should not occur when validating a valid JWT")
-				assert.Equal(t, userID, parsedUserID, "parsed userID should match the original userID")
+				assert.Equal(t, userID, claims.UserID, "parsed userID should match the original userID")
 			} else {
 				assert.Error(t, err, "error should occur when validating a token")
 				assert.ErrorIs(t, err, scenario.expectedError)
@@ -98,17 +98,92 @@ func TestMakeJWT_Expiration(t *testing.T) {
 	expiresIn := time.Millisecond * 10
 
 	// Generate JWT
-	token, err := auth.MakeJWT(userID, tokenSecret, expiresIn)
+	keys := mustHMACKeySet(t, tokenSecret)
+	token, err := auth.MakeJWT(userID, auth.AllScopes, keys, expiresIn)
 	assert.NoError(t, err, "error should not occur when generating a valid JWT")
 
 	// Wait for the token to expire
 	time.Sleep(time.Millisecond * 20)
 
 	// Validate the expired JWT
-	_, err = auth.ValidateJWT(token, tokenSecret)
+	_, err = auth.ValidateJWT(token, keys)
 	assert.Error(t, err, "error should occur when validating an expired JWT")
 }
 
+func TestMakeJWTExpiringAt(t *testing.T) {
+	keys := mustHMACKeySet(t, "TestSecret")
+	expiresAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+
+	token, err := auth.MakeJWTExpiringAt(uuid.New(), auth.AllScopes, keys, expiresAt)
+	require.NoError(t, err)
+
+	claims, err := auth.ValidateJWT(token, keys)
+	require.NoError(t, err)
+	assert.True(t, expiresAt.Equal(claims.ExpiresAt), "expiration should match the requested time")
+}
+
+func TestValidateJWT_Scopes(t *testing.T) {
+	keys := mustHMACKeySet(t, "TestSecret")
+	userID := uuid.New()
+
+	t.Run("scoped token", func(t *testing.T) {
+		token, err := auth.MakeJWT(userID, []string{auth.ScopeChirpsWrite}, keys, time.Hour)
+		require.NoError(t, err)
+
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		require.NoError(t, err)
+		assert.Equal(t, "chirps:write", parsed.Claims.(jwt.MapClaims)["scope"])
+
+		claims, err := auth.ValidateJWT(token, keys)
+		require.NoError(t, err)
+		assert.Equal(t, []string{auth.ScopeChirpsWrite}, claims.Scopes)
+		assert.True(t, claims.HasScopes(auth.ScopeChirpsWrite))
+		assert.False(t, claims.HasScopes(auth.ScopeChirpsWrite, auth.ScopeUsersWrite))
+	})
+
+	t.Run("token without scopes", func(t *testing.T) {
+		token, err := auth.MakeJWT(userID, nil, keys, time.Hour)
+		require.NoError(t, err)
+
+		claims, err := auth.ValidateJWT(token, keys)
+		require.NoError(t, err)
+		assert.Empty(t, claims.Scopes)
+		assert.False(t, claims.HasScopes(auth.ScopeChirpsRead))
+	})
+
+	t.Run("token issued before scopes were introduced", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Subject:   userID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}).SignedString([]byte("TestSecret"))
+		require.NoError(t, err)
+
+		claims, err := auth.ValidateJWT(token, keys)
+		require.NoError(t, err)
+		assert.True(t, claims.HasScopes(auth.AllScopes...))
+	})
+
+	t.Run("foreign issuer", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			Issuer:    "someone-else",
+			Subject:   userID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}).SignedString([]byte("TestSecret"))
+		require.NoError(t, err)
+
+		_, err = auth.ValidateJWT(token, keys)
+		assert.ErrorIs(t, err, jwt.ErrTokenInvalidIssuer)
+	})
+}
+
+func mustHMACKeySet(t *testing.T, secret string) *auth.KeySet {
+	t.Helper()
+	keys, err := auth.NewKeySet(auth.NewHMACKey([]byte(secret)))
+	require.NoError(t, err)
+	return keys
+}
+
 func runAuthTokenTests(t *testing.T, extractorFunc func(http.Header) (string, error), scheme string) {
 	scenarios := []struct {
 		name          string
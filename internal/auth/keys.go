@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"os"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing or verifying tokens.
+const minRSAKeyBits = 2048
+
+// Key is a key used to sign or verify JWTs. Asymmetric keys are identified by their
+// RFC 7638 thumbprint, which is sent as the "kid" header of the tokens they sign.
+// The legacy HMAC key has no ID and is never published.
+type Key struct {
+	// ID is the key ID sent in the "kid" header, empty for HMAC keys.
+	ID        string
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// NewHMACKey returns an HS256 key for the given shared secret.
+func NewHMACKey(secret []byte) *Key {
+	return &Key{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// LoadPEMKey reads a PEM encoded key from a file, see ParsePEMKey.
+func LoadPEMKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePEMKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ParsePEMKey parses a PEM encoded RSA or Ed25519 key. Private keys (PKCS #8, or PKCS #1 for RSA)
+// can sign and verify tokens, public keys (PKIX) can only verify them.
+// RSA keys sign with RS256 and Ed25519 keys with EdDSA.
+func ParsePEMKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.signKey, key.verifyKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.verifyKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.signKey, key.verifyKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.verifyKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	if pub, ok := key.verifyKey.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+	}
+
+	key.ID, err = thumbprint(key.JWK())
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Algorithm returns the JWS algorithm of the key, e.g. "RS256".
+func (k *Key) Algorithm() string {
+	return k.method.Alg()
+}
+
+// CanSign reports whether the key holds private material.
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 (RFC 8037)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public part of the key. It must not be called on HMAC keys.
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm()}
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
+
+// thumbprint computes the RFC 7638 thumbprint of a JWK: the SHA-256 digest of its
+// required members serialized in lexicographic order without whitespace.
+func thumbprint(jwk JWK) (string, error) {
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// KeySet holds the key new tokens are signed with and every key tokens are still accepted from.
+// Rotating keys is done by signing with a new key while keeping the previous one for
+// verification until the tokens it signed have expired.
+type KeySet struct {
+	signing *Key
+	// keys are the asymmetric keys by ID, including the signing key.
+	keys map[string]*Key
+	// hmac is the key used for tokens without a "kid" header.
+	hmac *Key
+}
+
+// NewKeySet returns a key set signing with the given key and verifying with it and the additional keys.
+// At most one HMAC key may be part of the set.
+func NewKeySet(signing *Key, verification ...*Key) (*KeySet, error) {
+	if signing == nil || !signing.CanSign() {
+		return nil, errors.New("signing key must be a private key")
+	}
+
+	ks := &KeySet{signing: signing, keys: make(map[string]*Key)}
+	for _, key := range append([]*Key{signing}, verification...) {
+		if key.ID == "" {
+			if ks.hmac != nil && ks.hmac != key {
+				return nil, errors.New("key set can hold only one HMAC key")
+			}
+			ks.hmac = key
+			continue
+		}
+		ks.keys[key.ID] = key
+	}
+	return ks, nil
+}
+
+// JWKS returns the public keys of the set. HMAC keys are never included.
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	// the signing key goes first, as it is the one most clients are looking for
+	if ks.signing.ID != "" {
+		jwks.Keys = append(jwks.Keys, ks.signing.JWK())
+	}
+	for _, id := range slices.Sorted(maps.Keys(ks.keys)) {
+		if id != ks.signing.ID {
+			jwks.Keys = append(jwks.Keys, ks.keys[id].JWK())
+		}
+	}
+	return jwks
+}
+
+// sign signs the claims with the signing key, setting the "kid" header for asymmetric keys.
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	if ks.signing.ID != "" {
+		token.Header["kid"] = ks.signing.ID
+	}
+	return token.SignedString(ks.signing.signKey)
+}
+
+// keyfunc looks up the verification key of a token by its "kid" header. The token algorithm
+// must match the algorithm of the key, so a public key can never be used as an HMAC secret.
+func (ks *KeySet) keyfunc(token *jwt.Token) (any, error) {
+	key := ks.hmac
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = ks.keys[kid]
+	}
+	if key == nil {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Algorithm() {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
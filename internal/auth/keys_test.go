@@ -0,0 +1,180 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szmktk/chirpy/internal/auth"
+)
+
+func encodePEM(t *testing.T, blockType string, der []byte) []byte {
+	t.Helper()
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func newRSAKeyPEM(t *testing.T) (private, public []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	return encodePEM(t, "PRIVATE KEY", privateDER), encodePEM(t, "PUBLIC KEY", publicDER)
+}
+
+func newEd25519KeyPEM(t *testing.T) (private, public []byte) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return encodePEM(t, "PRIVATE KEY", privateDER), encodePEM(t, "PUBLIC KEY", publicDER)
+}
+
+func TestParsePEMKey(t *testing.T) {
+	rsaPrivate, rsaPublic := newRSAKeyPEM(t)
+	edPrivate, edPublic := newEd25519KeyPEM(t)
+	smallRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	scenarios := []struct {
+		name          string
+		pem           []byte
+		expectedAlg   string
+		canSign       bool
+		expectedError string
+	}{
+		{name: "RSA private key", pem: rsaPrivate, expectedAlg: "RS256", canSign: true},
+		{name: "RSA public key", pem: rsaPublic, expectedAlg: "RS256"},
+		{name: "PKCS #1 RSA private key", pem: encodePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(smallRSA)), expectedError: "RSA key must be at least 2048 bits"},
+		{name: "Ed25519 private key", pem: edPrivate, expectedAlg: "EdDSA", canSign: true},
+		{name: "Ed25519 public key", pem: edPublic, expectedAlg: "EdDSA"},
+		{name: "not PEM", pem: []byte("secret"), expectedError: "no PEM data found"},
+		{name: "certificate", pem: encodePEM(t, "CERTIFICATE", []byte{0}), expectedError: `unsupported PEM block type "CERTIFICATE"`},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			key, err := auth.ParsePEMKey(scenario.pem)
+			if scenario.expectedError != "" {
+				assert.EqualError(t, err, scenario.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, scenario.expectedAlg, key.Algorithm())
+			assert.Equal(t, scenario.canSign, key.CanSign())
+			assert.NotEmpty(t, key.ID)
+		})
+	}
+}
+
+func TestParsePEMKey_Thumbprint(t *testing.T) {
+	// RSA key from RFC 7638 section 3.1
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	require.NoError(t, err)
+
+	key, err := auth.ParsePEMKey(encodePEM(t, "PUBLIC KEY", der))
+	require.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", key.ID)
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	oldPrivate, _ := newRSAKeyPEM(t)
+	newPrivate, _ := newEd25519KeyPEM(t)
+	oldKey, err := auth.ParsePEMKey(oldPrivate)
+	require.NoError(t, err)
+	newKey, err := auth.ParsePEMKey(newPrivate)
+	require.NoError(t, err)
+	hmacKey := auth.NewHMACKey([]byte("TestSecret"))
+	userID := uuid.New()
+
+	oldKeys, err := auth.NewKeySet(oldKey)
+	require.NoError(t, err)
+	legacyKeys, err := auth.NewKeySet(hmacKey)
+	require.NoError(t, err)
+	rotatedKeys, err := auth.NewKeySet(newKey, oldKey, hmacKey)
+	require.NoError(t, err)
+
+	oldToken, err := auth.MakeJWT(userID, auth.AllScopes, oldKeys, time.Hour)
+	require.NoError(t, err)
+	legacyToken, err := auth.MakeJWT(userID, auth.AllScopes, legacyKeys, time.Hour)
+	require.NoError(t, err)
+	newToken, err := auth.MakeJWT(userID, auth.AllScopes, rotatedKeys, time.Hour)
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+	assert.Equal(t, newKey.ID, parsed.Header["kid"])
+
+	for name, token := range map[string]string{"new": newToken, "old": oldToken, "legacy": legacyToken} {
+		t.Run(name, func(t *testing.T) {
+			claims, err := auth.ValidateJWT(token, rotatedKeys)
+			require.NoError(t, err)
+			assert.Equal(t, userID, claims.UserID)
+		})
+	}
+
+	t.Run("retired key", func(t *testing.T) {
+		newKeys, err := auth.NewKeySet(newKey)
+		require.NoError(t, err)
+		_, err = auth.ValidateJWT(oldToken, newKeys)
+		assert.ErrorContains(t, err, "unknown signing key")
+	})
+
+	t.Run("JWKS", func(t *testing.T) {
+		jwks := rotatedKeys.JWKS()
+		require.Len(t, jwks.Keys, 2)
+		assert.Equal(t, newKey.ID, jwks.Keys[0].Kid)
+		assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+		assert.Equal(t, oldKey.ID, jwks.Keys[1].Kid)
+		assert.Equal(t, "RSA", jwks.Keys[1].Kty)
+	})
+}
+
+func TestValidateJWT_AlgorithmConfusion(t *testing.T) {
+	private, public := newRSAKeyPEM(t)
+	key, err := auth.ParsePEMKey(private)
+	require.NoError(t, err)
+	keys, err := auth.NewKeySet(key)
+	require.NoError(t, err)
+
+	// a token signed with HS256 using the published public key as the secret must be rejected
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		Subject:   uuid.NewString(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	token.Header["kid"] = key.ID
+	forged, err := token.SignedString(public)
+	require.NoError(t, err)
+
+	_, err = auth.ValidateJWT(forged, keys)
+	assert.ErrorContains(t, err, `unexpected signing method "HS256"`)
+
+	_, err = auth.NewKeySet(mustParsePublic(t, public))
+	assert.EqualError(t, err, "signing key must be a private key")
+}
+
+func mustParsePublic(t *testing.T, public []byte) *auth.Key {
+	t.Helper()
+	key, err := auth.ParsePEMKey(public)
+	require.NoError(t, err)
+	return key
+}
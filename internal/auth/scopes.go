@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// Scopes limit what an access token may be used for. Tokens issued at login carry AllScopes,
+// narrower tokens can be handed to bots and integrations.
+const (
+	// ScopeChirpsRead allows reading the timeline of followed users.
+	ScopeChirpsRead = "chirps:read"
+	// ScopeChirpsWrite allows posting, editing, deleting and liking chirps.
+	ScopeChirpsWrite = "chirps:write"
+	// ScopeUsersRead allows reading own notifications.
+	ScopeUsersRead = "users:read"
+	// ScopeUsersWrite allows updating the profile, following users and marking notifications as read.
+	ScopeUsersWrite = "users:write"
+	// ScopeAccountManage allows managing sessions, two-factor authentication and access tokens.
+	ScopeAccountManage = "account:manage"
+)
+
+// AllScopes are the scopes granted to tokens issued at login.
+var AllScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeUsersRead, ScopeUsersWrite, ScopeAccountManage}
+
+// IsValidScope reports whether the scope is one of AllScopes.
+func IsValidScope(scope string) bool {
+	return slices.Contains(AllScopes, scope)
+}
+
+// formatScope joins scopes into the space separated "scope" claim (RFC 8693 section 4.2).
+func formatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// parseScope splits the space separated "scope" claim.
+func parseScope(scope string) []string {
+	return strings.Fields(scope)
+}
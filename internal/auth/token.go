@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// MakeOpaqueToken generates a secure random token carrying no information by itself,
+// e.g. for email verification links. Returns the token or an error if random data generation fails.
+func MakeOpaqueToken() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(key), nil
+}
+
+// HashToken returns the hex encoded SHA-256 digest of an opaque token.
+// Only the digest is stored, so a leaked database does not reveal usable tokens.
+// Opaque tokens carry enough entropy to not need a slow, salted hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MakeRecoveryCode generates a random single-use recovery code formatted for humans, e.g. "abcd-efgh-ijkl-mnop".
+// The 80 bits of entropy make it safe to store with HashToken after NormalizeRecoveryCode.
+func MakeRecoveryCode() (string, error) {
+	key := make([]byte, 10)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(totpEncoding.EncodeToString(key))
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// NormalizeRecoveryCode strips the formatting of a recovery code typed in by a user.
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// apiKeyPrefix marks Chirpy API keys, so leaked keys are easy to recognize, e.g. by secret scanners.
+const apiKeyPrefix = "chirpy_"
+
+// MakeAPIKey generates a new personal API key along with its public prefix, which identifies the key
+// in listings without revealing it. Like other opaque tokens, only HashToken of the key is stored.
+func MakeAPIKey() (key, prefix string, err error) {
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + token
+	return key, key[:len(apiKeyPrefix)+8], nil
+}
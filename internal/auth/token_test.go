@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashToken(t *testing.T) {
+	// SHA-256 of "abc" as given in FIPS 180-2.
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := HashToken("abc"); got != want {
+		t.Errorf("HashToken(%q) = %s, want %s", "abc", got, want)
+	}
+
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		t.Fatalf("MakeOpaqueToken() error = %v", err)
+	}
+	if HashToken(token) == token {
+		t.Error("expected hashed token to differ from the token")
+	}
+	if HashToken(token) != HashToken(token) {
+		t.Error("expected hashing to be deterministic")
+	}
+}
+
+func TestMakeRecoveryCode(t *testing.T) {
+	code, err := MakeRecoveryCode()
+	if err != nil {
+		t.Fatalf("MakeRecoveryCode() error = %v", err)
+	}
+	if len(code) != 19 || strings.Count(code, "-") != 3 {
+		t.Fatalf("expected a code formatted as xxxx-xxxx-xxxx-xxxx, got %q", code)
+	}
+
+	normalized := NormalizeRecoveryCode(code)
+	if len(normalized) != 16 {
+		t.Errorf("expected normalized code to have 16 characters, got %q", normalized)
+	}
+	if NormalizeRecoveryCode(" "+strings.ToUpper(code)+" ") != normalized {
+		t.Errorf("expected normalization to ignore case and whitespace")
+	}
+}
+
+func TestMakeAPIKey(t *testing.T) {
+	key, prefix, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("MakeAPIKey() error = %v", err)
+	}
+	if !strings.HasPrefix(key, "chirpy_") || len(key) != len("chirpy_")+64 {
+		t.Errorf("expected a chirpy_ prefixed key with 64 hex characters, got %q", key)
+	}
+	if len(prefix) != len("chirpy_")+8 || !strings.HasPrefix(key, prefix) {
+		t.Errorf("expected prefix %q to be the first 15 characters of the key", prefix)
+	}
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHOTP_RFC6238 checks the test vectors from RFC 6238 Appendix B.
+func TestHOTP_RFC6238(t *testing.T) {
+	seeds := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	hashes := map[string]func() hash.Hash{
+		"SHA1":   sha1.New,
+		"SHA256": sha256.New,
+		"SHA512": sha512.New,
+	}
+
+	tests := []struct {
+		unix int64
+		mode string
+		want string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, tt := range tests {
+		got := hotp(seeds[tt.mode], uint64(tt.unix/totpPeriod), 8, hashes[tt.mode])
+		if got != tt.want {
+			t.Errorf("TOTP(%s, %d) = %s, want %s", tt.mode, tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// Base32 encoding of the RFC 6238 SHA1 seed "12345678901234567890".
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	now := time.Unix(1111111109, 0)
+	// Last 6 digits of the RFC 6238 SHA1 vector for T = 1111111109.
+	code := "081804"
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     time.Time
+		want   bool
+	}{
+		{name: "current step", secret: secret, code: code, at: now, want: true},
+		{name: "lowercase secret", secret: strings.ToLower(secret), code: code, at: now, want: true},
+		{name: "previous step within skew", secret: secret, code: code, at: now.Add(30 * time.Second), want: true},
+		{name: "outside of skew", secret: secret, code: code, at: now.Add(2 * time.Minute), want: false},
+		{name: "wrong code", secret: secret, code: "123456", at: now, want: false},
+		{name: "wrong length", secret: secret, code: "81804", at: now, want: false},
+		{name: "invalid secret", secret: "not base32!", code: code, at: now, want: false},
+	}
+
+	if got, err := GenerateTOTPCode(secret, now); err != nil || got != code {
+		t.Errorf("GenerateTOTPCode() = %q, %v, want %q", got, err, code)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, tt.at)
+			if ok != tt.want {
+				t.Fatalf("ValidateTOTP() = %v, want %v", ok, tt.want)
+			}
+			if ok && step != now.Unix()/totpPeriod {
+				t.Errorf("expected matched step %d, got %d", now.Unix()/totpPeriod, step)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("expected a base32 encoded 160-bit secret, got %q", secret)
+	}
+
+	uri, err := url.Parse(TOTPURI(secret, "Chirpy", "alice@example.com"))
+	if err != nil {
+		t.Fatalf("failed to parse otpauth URI: %v", err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Chirpy:alice@example.com" {
+		t.Errorf("unexpected otpauth URI %s", uri)
+	}
+	if uri.Query().Get("secret") != secret || uri.Query().Get("issuer") != "Chirpy" {
+		t.Errorf("unexpected otpauth URI parameters %s", uri.RawQuery)
+	}
+}
@@ -0,0 +1,45 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szmktk/chirpy/internal/auth"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	secret := []byte("webhook-secret")
+	payload := []byte(`{"id":"evt_1","event":"user.upgraded"}`)
+	signedAt := time.Unix(1700000000, 0)
+	header := auth.SignWebhook(secret, signedAt, payload)
+
+	assert.Equal(t, "t=1700000000,v1=", header[:16])
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		header  string
+		payload []byte
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", secret, header, payload, signedAt.Add(time.Minute), nil},
+		{"clock skew", secret, header, payload, signedAt.Add(-time.Minute), nil},
+		{"rotated secret", secret, auth.SignWebhook([]byte("old-secret"), signedAt, payload) + "," + header[13:], payload, signedAt, nil},
+		{"wrong secret", []byte("other-secret"), header, payload, signedAt, auth.ErrInvalidSignature},
+		{"tampered payload", secret, header, []byte(`{"id":"evt_1","event":"user.downgraded"}`), signedAt, auth.ErrInvalidSignature},
+		{"tampered timestamp", secret, "t=1700000100" + header[12:], payload, signedAt, auth.ErrInvalidSignature},
+		{"missing signature", secret, "t=1700000000", payload, signedAt, auth.ErrInvalidSignature},
+		{"missing timestamp", secret, header[13:], payload, signedAt, auth.ErrInvalidSignature},
+		{"empty header", secret, "", payload, signedAt, auth.ErrInvalidSignature},
+		{"replayed", secret, header, payload, signedAt.Add(10 * time.Minute), auth.ErrSignatureExpired},
+		{"from the future", secret, header, payload, signedAt.Add(-10 * time.Minute), auth.ErrSignatureExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := auth.VerifyWebhookSignature(tt.secret, tt.header, tt.payload, tt.now, 5*time.Minute)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
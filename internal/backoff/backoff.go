@@ -0,0 +1,34 @@
+// Package backoff paces repeated work: failures are followed by exponentially growing delays,
+// and a backlog of due work is worked off right away instead of one batch per poll.
+package backoff
+
+import (
+	"context"
+	"time"
+)
+
+// maxShift caps the exponent of the back-off, keeping the delay computation from overflowing.
+const maxShift = 30
+
+// Delay returns base doubled n times, capped at limit. n below zero counts as zero.
+func Delay(base, limit time.Duration, n int) time.Duration {
+	delay := base << min(max(n, 0), maxShift)
+	if delay > limit || delay <= 0 {
+		delay = limit
+	}
+	return delay
+}
+
+// Drain calls process until it handles fewer than batchSize items, so a backlog does not have to wait
+// for the next poll. It stops at the first error and returns it.
+func Drain(ctx context.Context, batchSize int, process func(context.Context) (int, error)) error {
+	for {
+		n, err := process(ctx)
+		if err != nil {
+			return err
+		}
+		if n < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{n: -1, want: time.Second},
+		{n: 0, want: time.Second},
+		{n: 1, want: 2 * time.Second},
+		{n: 5, want: 32 * time.Second},
+		{n: 6, want: time.Minute},
+		{n: 1000, want: time.Minute},
+	}
+	for _, tt := range tests {
+		if got := Delay(time.Second, time.Minute, tt.n); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		name      string
+		batches   []int
+		err       error
+		wantCalls int
+	}{
+		{name: "idle", batches: []int{0}, wantCalls: 1},
+		{name: "backlog", batches: []int{10, 10, 3}, wantCalls: 3},
+		{name: "error", batches: []int{10, 10}, err: errors.New("connection reset"), wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Drain(context.Background(), 10, func(context.Context) (int, error) {
+				calls++
+				if tt.err != nil && calls == len(tt.batches) {
+					return 0, tt.err
+				}
+				return tt.batches[calls-1], nil
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Drain() error = %v, want %v", err, tt.err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -19,10 +20,75 @@ type Config struct {
 	DBURL string
 	// Platform is the running platform identifier (optional).
 	Platform string
-	// PolkaKey is the API key for Polka webhooks.
-	PolkaKey string
-	// TokenSecret is the secret used to sign JWTs.
+	// PolkaWebhookSecret is the shared secret Polka signs webhook payloads with.
+	PolkaWebhookSecret string
+	// PolkaWebhookTolerance is how far the timestamp of a signed webhook may be from the current time.
+	PolkaWebhookTolerance time.Duration
+	// WebhookAuditLogRetention is how long received webhooks are kept in the audit log.
+	WebhookAuditLogRetention time.Duration
+	// PlanFeatures maps subscription plans to the premium features they grant, users without a subscription
+	// are on the "free" plan. Nil means the built-in matrix.
+	PlanFeatures map[string][]string
+	// SubscriptionExpiryInterval is how often subscriptions past their paid period are expired.
+	SubscriptionExpiryInterval time.Duration
+	// TokenSecret is the secret used to sign JWTs with HS256 when no JWTSigningKeyFile is set.
+	// With a signing key file it is only used to verify tokens issued before the switch.
 	TokenSecret string
+	// JWTSigningKeyFile is the path to a PEM encoded RSA or Ed25519 private key used to sign JWTs (optional).
+	JWTSigningKeyFile string
+	// JWTVerificationKeyFiles are paths to PEM encoded keys still accepted when verifying JWTs,
+	// e.g. the previous signing key during a key rotation (optional).
+	JWTVerificationKeyFiles []string
+	// ChirpEditWindow is how long after creation a chirp can still be edited (zero means no limit).
+	ChirpEditWindow time.Duration
+	// BaseURL is the public URL of the service, used to build links sent by email (optional).
+	BaseURL string
+	// Mailer selects how emails are delivered: "smtp", "file" or "log" (default).
+	Mailer string
+	// MailFrom is the sender address of outgoing emails.
+	MailFrom string
+	// MailDir is the directory emails are written to by the "file" mailer.
+	MailDir string
+	// SMTPHost is the host of the SMTP relay used by the "smtp" mailer.
+	SMTPHost string
+	// SMTPPort is the port of the SMTP relay used by the "smtp" mailer.
+	SMTPPort int
+	// SMTPUsername is the SMTP username (optional).
+	SMTPUsername string
+	// SMTPPassword is the SMTP password (optional).
+	SMTPPassword string
+	// RequireVerifiedEmail blocks chirp creation until the user verifies their email address.
+	RequireVerifiedEmail bool
+	// LoginLockoutStore selects where failed login attempts are counted: "memory" (default, single instance) or "postgres".
+	LoginLockoutStore string
+	// LoginMaxFailures is the number of failed logins to an account before further attempts are delayed (zero disables it).
+	LoginMaxFailures int
+	// LoginMaxFailuresPerIP is the number of failed logins from a client IP before further attempts are delayed (zero disables it).
+	LoginMaxFailuresPerIP int
+	// LoginLockoutBaseDelay is the first delay once the threshold is reached, doubled with every further failure.
+	LoginLockoutBaseDelay time.Duration
+	// LoginLockoutMaxDelay caps the delay, locking the account or IP out for that long.
+	LoginLockoutMaxDelay time.Duration
+	// LoginLockoutWindow is how long failed logins are remembered after the last one.
+	LoginLockoutWindow time.Duration
+	// RateLimitStore selects where rate limit buckets are kept: "memory" (default, single instance),
+	// "postgres" (shared between replicas) or "none" to disable rate limiting.
+	RateLimitStore string
+	// OutboxDispatchInterval is how often recorded domain events are published.
+	OutboxDispatchInterval time.Duration
+	// OutboxRetention is how long published domain events are kept in the outbox.
+	OutboxRetention time.Duration
+	// WebhookMaxAttempts is the number of attempts after which an outgoing webhook delivery is given up.
+	WebhookMaxAttempts int
+	// WebhookTimeout bounds a single attempt to deliver an outgoing webhook.
+	WebhookTimeout time.Duration
+	// WebhookWorkerInterval is how often due outgoing webhook deliveries are sent.
+	WebhookWorkerInterval time.Duration
+	// WebhookAllowPrivateNetworks allows webhook endpoints on loopback and private addresses, for local development.
+	WebhookAllowPrivateNetworks bool
+	// TrustProxyHeaders makes the service take client IP addresses from the X-Forwarded-For header.
+	// Only enable it when running behind a reverse proxy that sets the header.
+	TrustProxyHeaders bool
 }
 
 // LoadConfig reads environment variables (optionally from a .env file) and returns a Config.
@@ -45,25 +111,263 @@ func LoadConfig() (*Config, error) {
 	if dbURL == "" {
 		missing = append(missing, "DB_URL")
 	}
-	polkaKey := os.Getenv("POLKA_KEY")
-	if polkaKey == "" {
-		missing = append(missing, "POLKA_KEY")
+	// POLKA_KEY is the name the secret had when Polka authenticated with a static API key
+	polkaWebhookSecret := os.Getenv("POLKA_WEBHOOK_SECRET")
+	if polkaWebhookSecret == "" {
+		polkaWebhookSecret = os.Getenv("POLKA_KEY")
+	}
+	if polkaWebhookSecret == "" {
+		missing = append(missing, "POLKA_WEBHOOK_SECRET")
 	}
 	tokenSecret := os.Getenv("TOKEN_SECRET")
-	if tokenSecret == "" {
+	jwtSigningKeyFile := os.Getenv("JWT_SIGNING_KEY_FILE")
+	if tokenSecret == "" && jwtSigningKeyFile == "" {
 		missing = append(missing, "TOKEN_SECRET")
 	}
+	var jwtVerificationKeyFiles []string
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFICATION_KEY_FILES"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			jwtVerificationKeyFiles = append(jwtVerificationKeyFiles, path)
+		}
+	}
 	platform := os.Getenv("PLATFORM")
 
+	var chirpEditWindow time.Duration
+	if windowStr := os.Getenv("CHIRP_EDIT_WINDOW"); windowStr != "" {
+		var err error
+		chirpEditWindow, err = time.ParseDuration(windowStr)
+		if err != nil || chirpEditWindow < 0 {
+			return nil, fmt.Errorf("invalid value for CHIRP_EDIT_WINDOW: %q", windowStr)
+		}
+	}
+
+	mailer := os.Getenv("MAILER")
+	if mailer == "" {
+		mailer = "log"
+	}
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "chirpy@localhost"
+	}
+	mailDir := os.Getenv("MAIL_DIR")
+	if mailDir == "" {
+		mailDir = "mail"
+	}
+	smtpHost := os.Getenv("SMTP_HOST")
+	smtpPort := 587
+	if smtpPortStr := os.Getenv("SMTP_PORT"); smtpPortStr != "" {
+		var err error
+		smtpPort, err = strconv.Atoi(smtpPortStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for SMTP_PORT: %s", err)
+		}
+	}
+	switch mailer {
+	case "smtp":
+		if smtpHost == "" {
+			missing = append(missing, "SMTP_HOST")
+		}
+	case "file", "log":
+	default:
+		return nil, fmt.Errorf("invalid value for MAILER: %q", mailer)
+	}
+
+	var requireVerifiedEmail bool
+	if requireStr := os.Getenv("REQUIRE_VERIFIED_EMAIL"); requireStr != "" {
+		var err error
+		requireVerifiedEmail, err = strconv.ParseBool(requireStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for REQUIRE_VERIFIED_EMAIL: %q", requireStr)
+		}
+	}
+
+	var trustProxyHeaders bool
+	if trustStr := os.Getenv("TRUST_PROXY_HEADERS"); trustStr != "" {
+		var err error
+		trustProxyHeaders, err = strconv.ParseBool(trustStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for TRUST_PROXY_HEADERS: %q", trustStr)
+		}
+	}
+
+	loginLockoutStore := os.Getenv("LOGIN_LOCKOUT_STORE")
+	if loginLockoutStore == "" {
+		loginLockoutStore = "memory"
+	}
+	if loginLockoutStore != "memory" && loginLockoutStore != "postgres" {
+		return nil, fmt.Errorf("invalid value for LOGIN_LOCKOUT_STORE: %q", loginLockoutStore)
+	}
+	loginMaxFailures, err := envInt("LOGIN_MAX_FAILURES", 5)
+	if err != nil {
+		return nil, err
+	}
+	loginMaxFailuresPerIP, err := envInt("LOGIN_MAX_FAILURES_PER_IP", 20)
+	if err != nil {
+		return nil, err
+	}
+	loginLockoutBaseDelay, err := envDuration("LOGIN_LOCKOUT_BASE_DELAY", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	loginLockoutMaxDelay, err := envDuration("LOGIN_LOCKOUT_MAX_DELAY", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	loginLockoutWindow, err := envDuration("LOGIN_LOCKOUT_WINDOW", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if loginLockoutMaxDelay < loginLockoutBaseDelay || loginLockoutWindow < loginLockoutMaxDelay {
+		return nil, fmt.Errorf("LOGIN_LOCKOUT_BASE_DELAY, LOGIN_LOCKOUT_MAX_DELAY and LOGIN_LOCKOUT_WINDOW must be in increasing order")
+	}
+
+	polkaWebhookTolerance, err := envDuration("POLKA_WEBHOOK_TOLERANCE", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	webhookAuditLogRetention, err := envDuration("WEBHOOK_AUDIT_LOG_RETENTION", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	planFeatures, err := parsePlanFeatures(os.Getenv("PLAN_FEATURES"))
+	if err != nil {
+		return nil, err
+	}
+	subscriptionExpiryInterval, err := envDuration("SUBSCRIPTION_EXPIRY_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	outboxDispatchInterval, err := envDuration("OUTBOX_DISPATCH_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	outboxRetention, err := envDuration("OUTBOX_RETENTION", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookMaxAttempts, err := envInt("WEBHOOK_MAX_ATTEMPTS", 12)
+	if err != nil {
+		return nil, err
+	}
+	if webhookMaxAttempts == 0 {
+		return nil, fmt.Errorf("invalid value for WEBHOOK_MAX_ATTEMPTS: %q", os.Getenv("WEBHOOK_MAX_ATTEMPTS"))
+	}
+	webhookTimeout, err := envDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	webhookWorkerInterval, err := envDuration("WEBHOOK_WORKER_INTERVAL", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	var webhookAllowPrivateNetworks bool
+	if allowStr := os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS"); allowStr != "" {
+		webhookAllowPrivateNetworks, err = strconv.ParseBool(allowStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for WEBHOOK_ALLOW_PRIVATE_NETWORKS: %q", allowStr)
+		}
+	}
+
+	rateLimitStore := os.Getenv("RATE_LIMIT_STORE")
+	if rateLimitStore == "" {
+		rateLimitStore = "memory"
+	}
+	switch rateLimitStore {
+	case "memory", "postgres", "none":
+	default:
+		return nil, fmt.Errorf("invalid value for RATE_LIMIT_STORE: %q", rateLimitStore)
+	}
+
 	if len(missing) > 0 {
 		return nil, fmt.Errorf("missing required env vars: %s", strings.Join(missing, ", "))
 	}
 	return &Config{
-		FilePathRoot: ".",
-		Port:         port,
-		DBURL:        dbURL,
-		Platform:     platform,
-		PolkaKey:     polkaKey,
-		TokenSecret:  tokenSecret,
+		FilePathRoot:                ".",
+		Port:                        port,
+		DBURL:                       dbURL,
+		Platform:                    platform,
+		PolkaWebhookSecret:          polkaWebhookSecret,
+		PolkaWebhookTolerance:       polkaWebhookTolerance,
+		WebhookAuditLogRetention:    webhookAuditLogRetention,
+		PlanFeatures:                planFeatures,
+		SubscriptionExpiryInterval:  subscriptionExpiryInterval,
+		TokenSecret:                 tokenSecret,
+		JWTSigningKeyFile:           jwtSigningKeyFile,
+		JWTVerificationKeyFiles:     jwtVerificationKeyFiles,
+		ChirpEditWindow:             chirpEditWindow,
+		BaseURL:                     strings.TrimSuffix(os.Getenv("BASE_URL"), "/"),
+		Mailer:                      mailer,
+		MailFrom:                    mailFrom,
+		MailDir:                     mailDir,
+		SMTPHost:                    smtpHost,
+		SMTPPort:                    smtpPort,
+		SMTPUsername:                os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:                os.Getenv("SMTP_PASSWORD"),
+		RequireVerifiedEmail:        requireVerifiedEmail,
+		TrustProxyHeaders:           trustProxyHeaders,
+		LoginLockoutStore:           loginLockoutStore,
+		LoginMaxFailures:            loginMaxFailures,
+		LoginMaxFailuresPerIP:       loginMaxFailuresPerIP,
+		LoginLockoutBaseDelay:       loginLockoutBaseDelay,
+		LoginLockoutMaxDelay:        loginLockoutMaxDelay,
+		LoginLockoutWindow:          loginLockoutWindow,
+		RateLimitStore:              rateLimitStore,
+		OutboxDispatchInterval:      outboxDispatchInterval,
+		OutboxRetention:             outboxRetention,
+		WebhookMaxAttempts:          webhookMaxAttempts,
+		WebhookTimeout:              webhookTimeout,
+		WebhookWorkerInterval:       webhookWorkerInterval,
+		WebhookAllowPrivateNetworks: webhookAllowPrivateNetworks,
 	}, nil
 }
+
+// envInt reads a non-negative integer from the environment, returning def when the variable is not set.
+func envInt(name string, def int) (int, error) {
+	str := os.Getenv(name)
+	if str == "" {
+		return def, nil
+	}
+	value, err := strconv.Atoi(str)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid value for %s: %q", name, str)
+	}
+	return value, nil
+}
+
+// envDuration reads a positive duration, e.g. "15m", from the environment, returning def when the variable is not set.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	str := os.Getenv(name)
+	if str == "" {
+		return def, nil
+	}
+	value, err := time.ParseDuration(str)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid value for %s: %q", name, str)
+	}
+	return value, nil
+}
+
+// parsePlanFeatures parses a plan to feature matrix of the form "plan=feature,feature;plan=feature".
+func parsePlanFeatures(str string) (map[string][]string, error) {
+	if strings.TrimSpace(str) == "" {
+		return nil, nil
+	}
+	planFeatures := make(map[string][]string)
+	for _, entry := range strings.Split(str, ";") {
+		plan, features, ok := strings.Cut(entry, "=")
+		plan = strings.TrimSpace(plan)
+		if !ok || plan == "" {
+			return nil, fmt.Errorf("invalid value for PLAN_FEATURES: %q", entry)
+		}
+		planFeatures[plan] = []string{}
+		for _, feature := range strings.Split(features, ",") {
+			if feature = strings.TrimSpace(feature); feature != "" {
+				planFeatures[plan] = append(planFeatures[plan], feature)
+			}
+		}
+	}
+	return planFeatures, nil
+}
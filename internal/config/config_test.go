@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig_Success(t *testing.T) {
@@ -22,8 +24,8 @@ func TestLoadConfig_Success(t *testing.T) {
 		t.Errorf("expected DBURL to be 'postgres://localhost/db', got %s", config.DBURL)
 	}
 
-	if config.PolkaKey != "examplePolkaKey" {
-		t.Errorf("expected PolkaKey to be 'examplePolkaKey', got %s", config.PolkaKey)
+	if config.PolkaWebhookSecret != "examplePolkaKey" {
+		t.Errorf("expected PolkaWebhookSecret to be 'examplePolkaKey', got %s", config.PolkaWebhookSecret)
 	}
 
 	if config.TokenSecret != "exampleTokenSecret" {
@@ -48,3 +50,286 @@ func TestLoadConfig_MissingVars(t *testing.T) {
 		t.Errorf("expected error message to be '%s', got %s", expectedError, err.Error())
 	}
 }
+
+func TestLoadConfig_ChirpEditWindow(t *testing.T) {
+	os.Setenv("DB_URL", "postgres://localhost/db")
+	os.Setenv("POLKA_KEY", "examplePolkaKey")
+	os.Setenv("TOKEN_SECRET", "exampleTokenSecret")
+	defer os.Unsetenv("DB_URL")
+	defer os.Unsetenv("POLKA_KEY")
+	defer os.Unsetenv("TOKEN_SECRET")
+	defer os.Unsetenv("CHIRP_EDIT_WINDOW")
+
+	os.Setenv("CHIRP_EDIT_WINDOW", "15m")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.ChirpEditWindow != 15*time.Minute {
+		t.Errorf("expected ChirpEditWindow to be 15m, got %s", config.ChirpEditWindow)
+	}
+
+	os.Setenv("CHIRP_EDIT_WINDOW", "soon")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected an error for invalid CHIRP_EDIT_WINDOW, got none")
+	}
+}
+
+func TestLoadConfig_Mailer(t *testing.T) {
+	os.Setenv("DB_URL", "postgres://localhost/db")
+	os.Setenv("POLKA_KEY", "examplePolkaKey")
+	os.Setenv("TOKEN_SECRET", "exampleTokenSecret")
+	defer os.Unsetenv("DB_URL")
+	defer os.Unsetenv("POLKA_KEY")
+	defer os.Unsetenv("TOKEN_SECRET")
+	defer os.Unsetenv("MAILER")
+	defer os.Unsetenv("SMTP_HOST")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.Mailer != "log" {
+		t.Errorf("expected Mailer to default to 'log', got %s", config.Mailer)
+	}
+
+	os.Setenv("MAILER", "smtp")
+	_, err = LoadConfig()
+	if err == nil || err.Error() != "missing required env vars: SMTP_HOST" {
+		t.Errorf("expected missing SMTP_HOST error, got %v", err)
+	}
+
+	os.Setenv("SMTP_HOST", "smtp.example.com")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.SMTPHost != "smtp.example.com" || config.SMTPPort != 587 {
+		t.Errorf("expected SMTP relay smtp.example.com:587, got %s:%d", config.SMTPHost, config.SMTPPort)
+	}
+
+	os.Setenv("MAILER", "pigeon")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected an error for invalid MAILER, got none")
+	}
+}
+
+func TestLoadConfig_JWTKeys(t *testing.T) {
+	os.Setenv("DB_URL", "postgres://localhost/db")
+	os.Setenv("POLKA_KEY", "examplePolkaKey")
+	os.Setenv("JWT_SIGNING_KEY_FILE", "keys/current.pem")
+	os.Setenv("JWT_VERIFICATION_KEY_FILES", "keys/previous.pem, keys/older.pem,")
+	defer os.Unsetenv("DB_URL")
+	defer os.Unsetenv("POLKA_KEY")
+	defer os.Unsetenv("JWT_SIGNING_KEY_FILE")
+	defer os.Unsetenv("JWT_VERIFICATION_KEY_FILES")
+
+	// TOKEN_SECRET is not required when tokens are signed with a private key
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.JWTSigningKeyFile != "keys/current.pem" {
+		t.Errorf("expected JWTSigningKeyFile to be 'keys/current.pem', got %s", config.JWTSigningKeyFile)
+	}
+	if len(config.JWTVerificationKeyFiles) != 2 || config.JWTVerificationKeyFiles[0] != "keys/previous.pem" || config.JWTVerificationKeyFiles[1] != "keys/older.pem" {
+		t.Errorf("unexpected JWTVerificationKeyFiles %q", config.JWTVerificationKeyFiles)
+	}
+
+	os.Unsetenv("JWT_SIGNING_KEY_FILE")
+	_, err = LoadConfig()
+	if err == nil || err.Error() != "missing required env vars: TOKEN_SECRET" {
+		t.Errorf("expected missing TOKEN_SECRET error, got %v", err)
+	}
+}
+
+func TestLoadConfig_LoginLockout(t *testing.T) {
+	os.Setenv("DB_URL", "postgres://localhost/db")
+	os.Setenv("POLKA_KEY", "examplePolkaKey")
+	os.Setenv("TOKEN_SECRET", "exampleTokenSecret")
+	defer os.Unsetenv("DB_URL")
+	defer os.Unsetenv("POLKA_KEY")
+	defer os.Unsetenv("TOKEN_SECRET")
+	defer os.Unsetenv("LOGIN_LOCKOUT_STORE")
+	defer os.Unsetenv("LOGIN_MAX_FAILURES")
+	defer os.Unsetenv("LOGIN_LOCKOUT_MAX_DELAY")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.LoginLockoutStore != "memory" || config.LoginMaxFailures != 5 || config.LoginMaxFailuresPerIP != 20 {
+		t.Errorf("unexpected defaults %q, %d, %d", config.LoginLockoutStore, config.LoginMaxFailures, config.LoginMaxFailuresPerIP)
+	}
+	if config.LoginLockoutBaseDelay != 30*time.Second || config.LoginLockoutMaxDelay != 15*time.Minute || config.LoginLockoutWindow != time.Hour {
+		t.Errorf("unexpected default delays %s, %s, %s", config.LoginLockoutBaseDelay, config.LoginLockoutMaxDelay, config.LoginLockoutWindow)
+	}
+
+	os.Setenv("LOGIN_LOCKOUT_STORE", "postgres")
+	os.Setenv("LOGIN_MAX_FAILURES", "0")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.LoginLockoutStore != "postgres" || config.LoginMaxFailures != 0 {
+		t.Errorf("expected postgres store with account lockout disabled, got %q, %d", config.LoginLockoutStore, config.LoginMaxFailures)
+	}
+
+	os.Setenv("LOGIN_LOCKOUT_MAX_DELAY", "2h")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected an error for a max delay longer than the window, got none")
+	}
+
+	os.Setenv("LOGIN_LOCKOUT_STORE", "redis")
+	if _, err := LoadConfig(); err == nil || err.Error() != `invalid value for LOGIN_LOCKOUT_STORE: "redis"` {
+		t.Errorf("expected invalid store error, got %v", err)
+	}
+}
+
+func TestLoadConfig_RateLimitStore(t *testing.T) {
+	os.Setenv("DB_URL", "postgres://localhost/db")
+	os.Setenv("POLKA_KEY", "examplePolkaKey")
+	os.Setenv("TOKEN_SECRET", "exampleTokenSecret")
+	defer os.Unsetenv("DB_URL")
+	defer os.Unsetenv("POLKA_KEY")
+	defer os.Unsetenv("TOKEN_SECRET")
+	defer os.Unsetenv("RATE_LIMIT_STORE")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.RateLimitStore != "memory" {
+		t.Errorf("expected memory store by default, got %q", config.RateLimitStore)
+	}
+
+	os.Setenv("RATE_LIMIT_STORE", "none")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.RateLimitStore != "none" {
+		t.Errorf("expected rate limiting to be disabled, got %q", config.RateLimitStore)
+	}
+
+	os.Setenv("RATE_LIMIT_STORE", "redis")
+	if _, err := LoadConfig(); err == nil || err.Error() != `invalid value for RATE_LIMIT_STORE: "redis"` {
+		t.Errorf("expected invalid store error, got %v", err)
+	}
+}
+
+func TestLoadConfig_PolkaWebhookSecret(t *testing.T) {
+	os.Setenv("DB_URL", "postgres://localhost/db")
+	os.Setenv("TOKEN_SECRET", "exampleTokenSecret")
+	os.Unsetenv("POLKA_KEY")
+	defer os.Unsetenv("DB_URL")
+	defer os.Unsetenv("TOKEN_SECRET")
+	defer os.Unsetenv("POLKA_KEY")
+	defer os.Unsetenv("POLKA_WEBHOOK_SECRET")
+	defer os.Unsetenv("POLKA_WEBHOOK_TOLERANCE")
+
+	if _, err := LoadConfig(); err == nil || err.Error() != "missing required env vars: POLKA_WEBHOOK_SECRET" {
+		t.Errorf("expected missing POLKA_WEBHOOK_SECRET error, got %v", err)
+	}
+
+	os.Setenv("POLKA_KEY", "examplePolkaKey")
+	os.Setenv("POLKA_WEBHOOK_SECRET", "exampleWebhookSecret")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.PolkaWebhookSecret != "exampleWebhookSecret" {
+		t.Errorf("expected POLKA_WEBHOOK_SECRET to take precedence over POLKA_KEY, got %s", config.PolkaWebhookSecret)
+	}
+	if config.PolkaWebhookTolerance != 5*time.Minute {
+		t.Errorf("expected default tolerance of 5m, got %s", config.PolkaWebhookTolerance)
+	}
+
+	os.Setenv("POLKA_WEBHOOK_TOLERANCE", "30s")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.PolkaWebhookTolerance != 30*time.Second {
+		t.Errorf("expected tolerance of 30s, got %s", config.PolkaWebhookTolerance)
+	}
+}
+
+func TestLoadConfig_PlanFeatures(t *testing.T) {
+	os.Setenv("DB_URL", "postgres://localhost/db")
+	os.Setenv("POLKA_KEY", "examplePolkaKey")
+	os.Setenv("TOKEN_SECRET", "exampleTokenSecret")
+	defer os.Unsetenv("DB_URL")
+	defer os.Unsetenv("POLKA_KEY")
+	defer os.Unsetenv("TOKEN_SECRET")
+	defer os.Unsetenv("PLAN_FEATURES")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.PlanFeatures != nil {
+		t.Errorf("expected the built-in matrix by default, got %v", config.PlanFeatures)
+	}
+
+	os.Setenv("PLAN_FEATURES", "free=; chirpy_red = long_chirps, chirp_editing ;chirpy_red_lite=long_chirps")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := map[string][]string{
+		"free":            {},
+		"chirpy_red":      {"long_chirps", "chirp_editing"},
+		"chirpy_red_lite": {"long_chirps"},
+	}
+	if !reflect.DeepEqual(config.PlanFeatures, want) {
+		t.Errorf("expected %v, got %v", want, config.PlanFeatures)
+	}
+
+	os.Setenv("PLAN_FEATURES", "chirpy_red")
+	if _, err := LoadConfig(); err == nil || err.Error() != `invalid value for PLAN_FEATURES: "chirpy_red"` {
+		t.Errorf("expected invalid matrix error, got %v", err)
+	}
+}
+
+func TestLoadConfig_Webhooks(t *testing.T) {
+	os.Setenv("DB_URL", "postgres://localhost/db")
+	os.Setenv("POLKA_KEY", "examplePolkaKey")
+	os.Setenv("TOKEN_SECRET", "exampleTokenSecret")
+	defer os.Unsetenv("DB_URL")
+	defer os.Unsetenv("POLKA_KEY")
+	defer os.Unsetenv("TOKEN_SECRET")
+	defer os.Unsetenv("WEBHOOK_MAX_ATTEMPTS")
+	defer os.Unsetenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if config.WebhookMaxAttempts != 12 || config.WebhookTimeout != 10*time.Second || config.WebhookWorkerInterval != 5*time.Second {
+		t.Errorf("unexpected webhook defaults: %+v", config)
+	}
+	if config.WebhookAllowPrivateNetworks {
+		t.Error("expected private networks to be refused by default")
+	}
+	if config.OutboxDispatchInterval != time.Second || config.OutboxRetention != 7*24*time.Hour {
+		t.Errorf("unexpected outbox defaults: %s, %s", config.OutboxDispatchInterval, config.OutboxRetention)
+	}
+	if config.WebhookAuditLogRetention != 30*24*time.Hour {
+		t.Errorf("unexpected webhook audit log retention: %s", config.WebhookAuditLogRetention)
+	}
+
+	os.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !config.WebhookAllowPrivateNetworks {
+		t.Error("expected private networks to be allowed")
+	}
+
+	os.Setenv("WEBHOOK_MAX_ATTEMPTS", "0")
+	if _, err := LoadConfig(); err == nil || err.Error() != `invalid value for WEBHOOK_MAX_ATTEMPTS: "0"` {
+		t.Errorf("expected invalid max attempts error, got %v", err)
+	}
+}
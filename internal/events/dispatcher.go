@@ -0,0 +1,154 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/szmktk/chirpy/internal/backoff"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+// pruneInterval is how often published events older than the retention are deleted.
+const pruneInterval = time.Hour
+
+// Sink receives published events. Publish may be called more than once for the same event.
+type Sink interface {
+	// Name identifies the sink in logs.
+	Name() string
+	Publish(ctx context.Context, event Event) error
+}
+
+// LogSink writes published events to the log.
+type LogSink struct {
+	logger *slog.Logger
+}
+
+// NewLogSink returns a sink logging events at info level.
+func NewLogSink(logger *slog.Logger) *LogSink {
+	return &LogSink{logger: logger}
+}
+
+func (s *LogSink) Name() string {
+	return "log"
+}
+
+func (s *LogSink) Publish(_ context.Context, event Event) error {
+	s.logger.Info("Published event", "event_id", event.ID, "type", event.Type, "user_id", event.UserID)
+	return nil
+}
+
+// Dispatcher publishes recorded events to its sinks. Any number of dispatchers may run against the same
+// database, each event is claimed by a single one. Events failing in any sink are retried with exponential
+// back-off, and never given up. Events are published in the order they were recorded, unless retried.
+type Dispatcher struct {
+	db     *database.Queries
+	sinks  []Sink
+	logger *slog.Logger
+	// BatchSize is the number of events claimed at once.
+	BatchSize int
+	// Lease is how long claimed events are reserved for the dispatcher publishing them.
+	Lease time.Duration
+	// BaseDelay is the delay before the first retry, doubled with every further attempt up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Retention is how long published events are kept, zero keeps them forever.
+	Retention time.Duration
+	now       func() time.Time
+}
+
+// NewDispatcher returns a dispatcher publishing events to the given sinks, in order.
+func NewDispatcher(db *database.Queries, logger *slog.Logger, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		db:        db,
+		sinks:     sinks,
+		logger:    logger,
+		BatchSize: 100,
+		Lease:     time.Minute,
+		BaseDelay: time.Second,
+		MaxDelay:  5 * time.Minute,
+		Retention: 7 * 24 * time.Hour,
+		now:       time.Now,
+	}
+}
+
+// Run publishes due events every interval until the context is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastPrune time.Time
+	for {
+		if err := backoff.Drain(ctx, d.BatchSize, d.ProcessBatch); err != nil {
+			d.logger.Error("Error publishing events", "err", err)
+		}
+		if d.Retention > 0 && d.now().Sub(lastPrune) >= pruneInterval {
+			lastPrune = d.now()
+			if _, err := d.Prune(ctx); err != nil {
+				d.logger.Error("Error pruning published events", "err", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessBatch claims up to BatchSize due events and publishes them, returning how many were claimed.
+func (d *Dispatcher) ProcessBatch(ctx context.Context) (int, error) {
+	rows, err := d.db.ClaimOutboxEvents(ctx, database.ClaimOutboxEventsParams{
+		BatchSize:    int32(d.BatchSize),
+		LeaseSeconds: d.Lease.Seconds(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if err := d.dispatch(ctx, row); err != nil {
+			d.logger.Error("Error recording event outcome", "event_id", row.ID, "err", err)
+		}
+	}
+	return len(rows), nil
+}
+
+// Prune deletes events published longer than Retention ago, returning how many were deleted.
+func (d *Dispatcher) Prune(ctx context.Context) (int64, error) {
+	return d.db.DeletePublishedOutboxEvents(ctx, d.Retention.Seconds())
+}
+
+// dispatch publishes the event to every sink, marking it published once all of them succeeded.
+func (d *Dispatcher) dispatch(ctx context.Context, row database.Outbox) error {
+	event := Event{
+		ID:         row.ID,
+		Type:       row.EventType,
+		UserID:     row.UserID,
+		OccurredAt: row.CreatedAt,
+		Data:       []byte(row.Payload),
+	}
+
+	var errs []error
+	for _, sink := range d.sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		delay := d.delay(int(row.Attempts))
+		d.logger.Warn("Error publishing event, retrying", "event_id", event.ID, "type", event.Type, "attempts", row.Attempts, "retry_in", delay, "err", err)
+		return d.db.RetryOutboxEvent(ctx, database.RetryOutboxEventParams{
+			DelaySeconds: delay.Seconds(),
+			LastError:    sql.NullString{String: err.Error(), Valid: true},
+			ID:           row.ID,
+		})
+	}
+	return d.db.MarkOutboxEventPublished(ctx, row.ID)
+}
+
+// delay returns how long to wait after the given number of failed attempts.
+func (d *Dispatcher) delay(attempts int) time.Duration {
+	return backoff.Delay(d.BaseDelay, d.MaxDelay, attempts-1)
+}
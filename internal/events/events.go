@@ -0,0 +1,57 @@
+// Package events records domain events in a transactional outbox and publishes them to sinks.
+//
+// Handlers call Record with queries bound to the transaction that makes the change an event describes,
+// so the event is stored if, and only if, the change is committed. A Dispatcher then claims recorded
+// events and hands them to every Sink, retrying until all of them succeed. Events are published at least
+// once: a sink may see an event again after a failure or a crash, and must tolerate that, e.g. by using
+// the event ID as an idempotency key.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+// Event types. Events belong to the account they are about, e.g. chirp.liked to the author of the chirp.
+const (
+	// ChirpCreated is recorded when a user posts a chirp, with the chirp as data.
+	ChirpCreated = "chirp.created"
+	// ChirpUpdated is recorded when a user edits a chirp, with the edited chirp as data.
+	ChirpUpdated = "chirp.updated"
+	// ChirpDeleted is recorded when a user deletes a chirp, with the chirp as data.
+	ChirpDeleted = "chirp.deleted"
+	// ChirpLiked is recorded when someone likes a chirp of the user, with chirp_id and user_id of the liker as data.
+	ChirpLiked = "chirp.liked"
+	// UserFollowed is recorded when someone follows the user, with follower_id and followee_id as data.
+	UserFollowed = "user.followed"
+	// SubscriptionUpdated is recorded when a payment event changes the subscription of the user.
+	SubscriptionUpdated = "subscription.updated"
+)
+
+// Event is a change that happened in Chirpy.
+type Event struct {
+	ID         uuid.UUID
+	Type       string
+	UserID     uuid.UUID
+	OccurredAt time.Time
+	// Data is the JSON encoded description of the change, its shape depends on the type.
+	Data json.RawMessage
+}
+
+// Record writes an event to the outbox. db must be bound to the transaction making the change.
+func Record(ctx context.Context, db *database.Queries, eventType string, userID uuid.UUID, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return db.InsertOutboxEvent(ctx, database.InsertOutboxEventParams{
+		ID:        uuid.New(),
+		EventType: eventType,
+		UserID:    userID,
+		Payload:   string(payload),
+	})
+}
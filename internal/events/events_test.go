@@ -0,0 +1,153 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+var outboxColumns = []string{"id", "event_type", "user_id", "payload", "created_at", "attempts", "next_attempt_at", "last_error", "published_at"}
+
+// recordingSink records published events and fails with err, if set.
+type recordingSink struct {
+	published []Event
+	err       error
+}
+
+func (s *recordingSink) Name() string {
+	return "recording"
+}
+
+func (s *recordingSink) Publish(_ context.Context, event Event) error {
+	s.published = append(s.published, event)
+	return s.err
+}
+
+// failingSink is a recordingSink with another name.
+type failingSink struct {
+	recordingSink
+}
+
+func (s *failingSink) Name() string {
+	return "failing"
+}
+
+func TestRecord(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	userID := uuid.New()
+	mock.ExpectExec("INSERT INTO outbox").
+		WithArgs(sqlmock.AnyArg(), ChirpLiked, userID, `{"chirp_id":"abc"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := Record(context.Background(), database.New(db), ChirpLiked, userID, map[string]string{"chirp_id": "abc"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestDispatcherProcessBatch(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		sinkErr       error
+		attempts      int32
+		expectOutcome func(mock sqlmock.Sqlmock, id uuid.UUID)
+	}{
+		{
+			name:     "published",
+			attempts: 1,
+			expectOutcome: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectExec("UPDATE outbox SET published_at").
+					WithArgs(id).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:     "retried with back-off",
+			sinkErr:  errors.New("connection refused"),
+			attempts: 3,
+			expectOutcome: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectExec("UPDATE outbox SET next_attempt_at").
+					WithArgs(float64(4), sql.NullString{String: "failing: connection refused", Valid: true}, id).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			ok := &recordingSink{}
+			failing := &failingSink{recordingSink{err: tt.sinkErr}}
+			dispatcher := NewDispatcher(database.New(db), slog.New(slog.NewTextHandler(io.Discard, nil)), ok, failing)
+			dispatcher.now = func() time.Time { return now }
+
+			eventID, userID := uuid.New(), uuid.New()
+			mock.ExpectQuery("WITH due AS").
+				WithArgs(int32(100), float64(60)).
+				WillReturnRows(sqlmock.NewRows(outboxColumns).
+					AddRow(eventID, ChirpCreated, userID, `{"body":"hello"}`, now, tt.attempts, now.Add(time.Minute), nil, nil))
+			tt.expectOutcome(mock, eventID)
+
+			published, err := dispatcher.ProcessBatch(context.Background())
+			if err != nil {
+				t.Fatalf("ProcessBatch() error = %v", err)
+			}
+			if published != 1 {
+				t.Errorf("expected 1 event to be claimed, got %d", published)
+			}
+			// every sink sees the event, even when another one fails
+			for _, sink := range []*recordingSink{ok, &failing.recordingSink} {
+				if len(sink.published) != 1 {
+					t.Fatalf("expected the event to be published to every sink, got %d", len(sink.published))
+				}
+				event := sink.published[0]
+				if event.ID != eventID || event.Type != ChirpCreated || event.UserID != userID || string(event.Data) != `{"body":"hello"}` {
+					t.Errorf("unexpected event %+v", event)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestDispatcherDelay(t *testing.T) {
+	dispatcher := NewDispatcher(nil, nil)
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 4, want: 8 * time.Second},
+		{attempts: 10, want: 5 * time.Minute},
+		{attempts: 100, want: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := dispatcher.delay(tt.attempts); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
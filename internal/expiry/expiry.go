@@ -0,0 +1,36 @@
+// Package expiry helps stores keeping short-lived entries, such as login failures or rate limit buckets,
+// forget them once they no longer matter.
+package expiry
+
+import (
+	"sync"
+	"time"
+)
+
+// PruneInterval is how often stores drop expired entries.
+const PruneInterval = time.Minute
+
+// Now returns the current time in UTC. Timestamps are stored without a time zone, so stores
+// comparing them with the current time have to keep them in UTC.
+func Now() time.Time {
+	return time.Now().UTC()
+}
+
+// Pruner tells a store when to drop expired entries, so they do not pile up while every
+// operation does not have to scan for them. The zero value is ready to use.
+type Pruner struct {
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+// Due reports whether more than PruneInterval has passed since the store last pruned, at the given time.
+// When it returns true the store is expected to prune, and Due returns false for another interval.
+func (p *Pruner) Due(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now.Sub(p.lastPruned) <= PruneInterval {
+		return false
+	}
+	p.lastPruned = now
+	return true
+}
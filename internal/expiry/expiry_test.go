@@ -0,0 +1,27 @@
+package expiry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrunerDue(t *testing.T) {
+	var pruner Pruner
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{at: start, want: true},
+		{at: start.Add(30 * time.Second), want: false},
+		{at: start.Add(PruneInterval), want: false},
+		{at: start.Add(PruneInterval + time.Second), want: true},
+		{at: start.Add(PruneInterval + 2*time.Second), want: false},
+	}
+	for _, tt := range tests {
+		if got := pruner.Due(tt.at); got != tt.want {
+			t.Errorf("Due(%s) = %v, want %v", tt.at.Sub(start), got, tt.want)
+		}
+	}
+}
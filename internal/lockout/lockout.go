@@ -0,0 +1,118 @@
+// Package lockout slows down password guessing by delaying attempts after repeated failures.
+//
+// Failures are counted per key, e.g. an account or a client IP address. Once a key reaches the
+// failure threshold of its Policy, every further attempt has to wait for an exponentially growing
+// delay after the last failure, up to a maximum at which the key is effectively locked out.
+//
+// Attempts are reserved, i.e. counted as failed, before they are made, so that concurrent attempts
+// cannot all pass the check before any of their failures is counted. Successful attempts are refunded.
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"github.com/szmktk/chirpy/internal/backoff"
+	"github.com/szmktk/chirpy/internal/expiry"
+)
+
+// Attempts are the failures counted for a key.
+type Attempts struct {
+	// Failures is the number of consecutive failed attempts.
+	Failures int
+	// LastFailure is when the most recent failed attempt happened.
+	LastFailure time.Time
+}
+
+// Store keeps failure counts. The memory store suits a single instance,
+// the Postgres store shares counts between instances.
+type Store interface {
+	// Reserve counts an attempt made at the given time as failed and returns the failures counted before it.
+	// Failures made before the window started are forgotten first.
+	Reserve(ctx context.Context, key string, at time.Time, windowStart time.Time) (Attempts, error)
+	// Refund takes back the attempt reserved at the given time. The last failure is restored to the previous
+	// one returned by Reserve, unless another attempt was reserved in the meantime.
+	Refund(ctx context.Context, key string, at time.Time, previous Attempts) error
+	// Reset forgets the failures counted for the key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy configures when attempts are delayed. The zero value disables the lockout.
+type Policy struct {
+	// Threshold is the number of failures allowed before attempts are delayed, zero disables the lockout.
+	Threshold int
+	// BaseDelay is the delay after reaching the threshold, doubled with every further failure.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay. Keys waiting this long are locked out.
+	MaxDelay time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// delay returns how long to wait after the last of the given number of failures.
+func (p Policy) delay(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+	return backoff.Delay(p.BaseDelay, p.MaxDelay, failures-p.Threshold)
+}
+
+// Limiter applies a Policy to the failures counted in a Store.
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+// New returns a limiter applying the policy to failures counted in the store.
+func New(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy, now: expiry.Now}
+}
+
+// Reservation is an attempt counted as failed until it is refunded.
+type Reservation struct {
+	key      string
+	at       time.Time
+	previous Attempts
+}
+
+// Reserve counts an attempt of the key as failed before it is made and returns how long the key has to wait
+// before it may try, zero when it may try right away. An attempt that has to wait is refunded at once and
+// must not be made.
+func (l *Limiter) Reserve(ctx context.Context, key string) (Reservation, time.Duration, error) {
+	if l.policy.Threshold <= 0 {
+		return Reservation{}, 0, nil
+	}
+	now := l.now()
+	previous, err := l.store.Reserve(ctx, key, now, now.Add(-l.policy.Window))
+	if err != nil {
+		return Reservation{}, 0, err
+	}
+	if previous.Failures == 0 {
+		return Reservation{key: key, at: now}, 0, nil
+	}
+	wait := previous.LastFailure.Add(l.policy.delay(previous.Failures)).Sub(now)
+	if wait <= 0 {
+		return Reservation{key: key, at: now, previous: previous}, 0, nil
+	}
+	if err := l.store.Refund(ctx, key, now, previous); err != nil {
+		return Reservation{}, 0, err
+	}
+	return Reservation{}, wait, nil
+}
+
+// Refund takes back a reserved attempt that did not fail. Refunding the zero Reservation does nothing.
+func (l *Limiter) Refund(ctx context.Context, r Reservation) error {
+	if r.key == "" {
+		return nil
+	}
+	return l.store.Refund(ctx, r.key, r.at, r.previous)
+}
+
+// Succeed forgets the failures of the key after a successful attempt.
+func (l *Limiter) Succeed(ctx context.Context, key string) error {
+	if l.policy.Threshold <= 0 {
+		return nil
+	}
+	return l.store.Reset(ctx, key)
+}
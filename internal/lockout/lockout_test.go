@@ -0,0 +1,154 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{Threshold: 3, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 8, want: 32 * time.Second},
+		{failures: 9, want: time.Minute},
+		{failures: 1000, want: time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+
+	if got := (Policy{}).delay(100); got != 0 {
+		t.Errorf("expected the zero policy to never delay, got %s", got)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := New(NewMemoryStore(), Policy{Threshold: 2, BaseDelay: 10 * time.Second, MaxDelay: time.Minute, Window: time.Hour})
+	limiter.now = func() time.Time { return now }
+
+	reserve := func(want time.Duration) Reservation {
+		t.Helper()
+		r, got, err := limiter.Reserve(ctx, "account:a@example.com")
+		if err != nil {
+			t.Fatalf("Reserve() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("Reserve() wait = %s, want %s", got, want)
+		}
+		return r
+	}
+
+	// reserved attempts count as failures until they are refunded
+	reserve(0)
+	reserve(0)
+	reserve(10 * time.Second)
+
+	// an attempt that has to wait is not counted
+	now = now.Add(4 * time.Second)
+	reserve(6 * time.Second)
+
+	now = now.Add(6 * time.Second)
+	reserve(0)
+	now = now.Add(10 * time.Second)
+	reserve(10 * time.Second)
+
+	// a refunded attempt restores the delay after the failure before it
+	now = now.Add(10 * time.Second)
+	r := reserve(0)
+	if err := limiter.Refund(ctx, r); err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	reserve(0)
+	reserve(40 * time.Second)
+
+	// other keys are not affected
+	if _, got, _ := limiter.Reserve(ctx, "ip:192.0.2.1"); got != 0 {
+		t.Errorf("expected other keys to not be delayed, got %s", got)
+	}
+
+	// failures are forgotten after the window
+	now = now.Add(2 * time.Hour)
+	reserve(0)
+	reserve(0)
+
+	// and on success
+	reserve(10 * time.Second)
+	if err := limiter.Succeed(ctx, "account:a@example.com"); err != nil {
+		t.Fatalf("Succeed() error = %v", err)
+	}
+	reserve(0)
+}
+
+func TestLimiter_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(NewMemoryStore(), Policy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour})
+
+	// however many attempts race, only the ones below the threshold are let through
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, wait, err := limiter.Reserve(ctx, "key"); err == nil && wait == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := allowed.Load(); got != 3 {
+		t.Errorf("expected 3 attempts to be allowed, got %d", got)
+	}
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(NewMemoryStore(), Policy{})
+	for range 10 {
+		r, wait, err := limiter.Reserve(ctx, "key")
+		if err != nil {
+			t.Fatalf("Reserve() error = %v", err)
+		}
+		if wait != 0 {
+			t.Fatalf("expected a disabled limiter to never delay, got %s", wait)
+		}
+		if err := limiter.Refund(ctx, r); err != nil {
+			t.Fatalf("Refund() error = %v", err)
+		}
+	}
+}
+
+func TestMemoryStore_Prune(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := store.Reserve(ctx, "old", start, start.Add(-time.Hour)); err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	later := start.Add(2 * time.Hour)
+	if _, err := store.Reserve(ctx, "new", later, later.Add(-time.Hour)); err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	if _, ok := store.attempts["old"]; ok {
+		t.Error("expected forgotten failures to be pruned")
+	}
+	if a := store.attempts["new"]; a.Failures != 1 {
+		t.Errorf("expected 1 failure for the new key, got %d", a.Failures)
+	}
+}
@@ -0,0 +1,68 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/szmktk/chirpy/internal/expiry"
+)
+
+// MemoryStore counts failures in memory. Counts are lost on restart and not shared between instances.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+	pruner   expiry.Pruner
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: make(map[string]Attempts)}
+}
+
+func (s *MemoryStore) Reserve(_ context.Context, key string, at time.Time, windowStart time.Time) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pruner.Due(at) {
+		for k, a := range s.attempts {
+			if a.LastFailure.Before(windowStart) {
+				delete(s.attempts, k)
+			}
+		}
+	}
+
+	previous := s.attempts[key]
+	if previous.LastFailure.Before(windowStart) {
+		previous = Attempts{}
+	}
+	s.attempts[key] = Attempts{Failures: previous.Failures + 1, LastFailure: at}
+	return previous, nil
+}
+
+func (s *MemoryStore) Refund(_ context.Context, key string, at time.Time, previous Attempts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok {
+		return nil
+	}
+	attempts.Failures--
+	if attempts.Failures <= 0 {
+		delete(s.attempts, key)
+		return nil
+	}
+	if attempts.LastFailure.Equal(at) && !previous.LastFailure.IsZero() {
+		attempts.LastFailure = previous.LastFailure
+	}
+	s.attempts[key] = attempts
+	return nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
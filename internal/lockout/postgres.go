@@ -0,0 +1,56 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/expiry"
+)
+
+// PostgresStore counts failures in the login_attempts table, sharing them between instances.
+type PostgresStore struct {
+	db     *database.Queries
+	pruner expiry.Pruner
+}
+
+// NewPostgresStore returns a store backed by the login_attempts table.
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Reserve(ctx context.Context, key string, at time.Time, windowStart time.Time) (Attempts, error) {
+	// forgotten failures are deleted now and then, so keys of guessed accounts do not pile up
+	if s.pruner.Due(at) {
+		if _, err := s.db.DeleteStaleLoginAttempts(ctx, windowStart); err != nil {
+			return Attempts{}, err
+		}
+	}
+
+	// the upsert locks the row, so concurrent attempts of a key are counted one after another
+	row, err := s.db.ReserveLoginAttempt(ctx, database.ReserveLoginAttemptParams{
+		Key:         key,
+		ReservedAt:  at,
+		WindowStart: windowStart,
+	})
+	if err != nil {
+		return Attempts{}, err
+	}
+	if row.Failures <= 1 || !row.PreviousFailureAt.Valid {
+		return Attempts{}, nil
+	}
+	return Attempts{Failures: int(row.Failures) - 1, LastFailure: row.PreviousFailureAt.Time}, nil
+}
+
+func (s *PostgresStore) Refund(ctx context.Context, key string, at time.Time, previous Attempts) error {
+	return s.db.RefundLoginAttempt(ctx, database.RefundLoginAttemptParams{
+		ReservedAt:        at,
+		PreviousFailureAt: sql.NullTime{Time: previous.LastFailure, Valid: !previous.LastFailure.IsZero()},
+		Key:               key,
+	})
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.db.ResetLoginAttempts(ctx, key)
+}
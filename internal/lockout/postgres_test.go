@@ -0,0 +1,87 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+func TestPostgresStore_Reserve(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	store := NewPostgresStore(database.New(db))
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	windowStart := now.Add(-time.Hour)
+	columns := []string{"key", "failures", "last_failure_at", "previous_failure_at"}
+
+	// the first attempt prunes forgotten failures, the next one within the prune interval does not
+	mock.ExpectExec("DELETE FROM login_attempts").
+		WithArgs(windowStart).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery("INSERT INTO login_attempts").
+		WithArgs("account:a@example.com", now, windowStart).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("account:a@example.com", 1, now, nil))
+	later := now.Add(time.Second)
+	mock.ExpectQuery("INSERT INTO login_attempts").
+		WithArgs("account:a@example.com", later, windowStart.Add(time.Second)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("account:a@example.com", 2, later, now))
+
+	previous, err := store.Reserve(ctx, "account:a@example.com", now, windowStart)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	if previous != (Attempts{}) {
+		t.Errorf("expected no failures before the first attempt, got %+v", previous)
+	}
+	previous, err = store.Reserve(ctx, "account:a@example.com", later, windowStart.Add(time.Second))
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	if previous.Failures != 1 || !previous.LastFailure.Equal(now) {
+		t.Errorf("unexpected previous attempts %+v", previous)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestPostgresStore_Refund(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	store := NewPostgresStore(database.New(db))
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Minute)
+
+	mock.ExpectExec("UPDATE login_attempts").
+		WithArgs(now, earlier, "ip:192.0.2.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// without a failure before the attempt the last failure is kept
+	mock.ExpectExec("UPDATE login_attempts").
+		WithArgs(now, nil, "ip:192.0.2.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.Refund(ctx, "ip:192.0.2.1", now, Attempts{Failures: 1, LastFailure: earlier}); err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	if err := store.Refund(ctx, "ip:192.0.2.1", now, Attempts{}); err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer, err := NewFileMailer(dir, "chirpy@example.com")
+	if err != nil {
+		t.Fatalf("failed to create mailer: %v", err)
+	}
+
+	msg := Message{To: "alice@example.com", Subject: "Hello", Body: "line one\nline two"}
+	if err := mailer.Send(context.Background(), msg); err != nil {
+		t.Fatalf("failed to send email: %v", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected a single email file, got %v (%v)", files, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatalf("failed to read email file: %v", err)
+	}
+	content := string(data)
+	for _, want := range []string{"From: chirpy@example.com\r\n", "To: alice@example.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline one\r\nline two"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected email to contain %q, got %q", want, content)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveSMTP accepts a single connection and answers it with a minimal SMTP server, returning the received data.
+func serveSMTP(t *testing.T, ln net.Listener) <-chan string {
+	t.Helper()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				reply("250 ok")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				received <- data.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return received
+}
+
+func newTestSMTPMailer(t *testing.T, ln net.Listener) *SMTPMailer {
+	t.Helper()
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to split address: %v", err)
+	}
+	p, _ := strconv.Atoi(port)
+	return NewSMTPMailer(host, p, "", "", "chirpy@example.com")
+}
+
+func TestSMTPMailer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	received := serveSMTP(t, ln)
+
+	mailer := newTestSMTPMailer(t, ln)
+	msg := Message{To: "alice@example.com", Subject: "Hello", Body: "line one"}
+	if err := mailer.Send(context.Background(), msg); err != nil {
+		t.Fatalf("failed to send email: %v", err)
+	}
+
+	data := <-received
+	if !strings.Contains(data, "Subject: Hello\r\n") || !strings.Contains(data, "line one") {
+		t.Errorf("unexpected email data %q", data)
+	}
+}
+
+func TestSMTPMailer_Timeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// the relay accepts connections but never greets the client
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(5 * time.Second)
+	}()
+
+	mailer := newTestSMTPMailer(t, ln)
+	mailer.timeout = 100 * time.Millisecond
+	start := time.Now()
+	if err := mailer.Send(context.Background(), Message{To: "alice@example.com"}); err == nil {
+		t.Fatal("expected an error from a relay that does not respond")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the send to give up after the timeout, took %s", elapsed)
+	}
+}
+
+func TestSMTPMailer_Canceled(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(5 * time.Second)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	if err := newTestSMTPMailer(t, ln).Send(ctx, Message{To: "alice@example.com"}); err == nil {
+		t.Fatal("expected an error when the context is canceled")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the send to stop when the context is canceled, took %s", elapsed)
+	}
+}
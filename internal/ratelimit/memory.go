@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/szmktk/chirpy/internal/expiry"
+)
+
+// MemoryStore keeps buckets in memory. Buckets are lost on restart and not shared between replicas.
+type MemoryStore struct {
+	mu     sync.Mutex
+	tats   map[string]time.Time
+	pruner expiry.Pruner
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tats: make(map[string]time.Time)}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, now time.Time, interval time.Duration, maxTAT time.Time) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pruner.Due(now) {
+		for k, tat := range s.tats {
+			if tat.Before(now) {
+				delete(s.tats, k)
+			}
+		}
+	}
+
+	tat, ok := s.tats[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(interval)
+	if next.After(maxTAT) {
+		return tat, false, nil
+	}
+	s.tats[key] = next
+	return next, true, nil
+}
+
+func (s *MemoryStore) Refund(_ context.Context, key string, interval time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tat, ok := s.tats[key]; ok {
+		s.tats[key] = tat.Add(-interval)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/expiry"
+)
+
+// PostgresStore keeps buckets in the rate_limits table, so limits hold across replicas.
+type PostgresStore struct {
+	db     *database.Queries
+	pruner expiry.Pruner
+}
+
+// NewPostgresStore returns a store backed by the rate_limits table.
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, now time.Time, interval time.Duration, maxTAT time.Time) (time.Time, bool, error) {
+	// full buckets are deleted now and then
+	if s.pruner.Due(now) {
+		if _, err := s.db.DeleteExpiredRateLimits(ctx, now); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+
+	tat, err := s.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:             key,
+		Now:             now,
+		IntervalSeconds: interval.Seconds(),
+		MaxTat:          maxTAT,
+	})
+	if err == nil {
+		return tat, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, err
+	}
+
+	// the bucket is empty, read its TAT to tell the client when to retry
+	tat, err = s.db.GetRateLimit(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return maxTAT, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return tat, false, nil
+}
+
+func (s *PostgresStore) Refund(ctx context.Context, key string, interval time.Duration) error {
+	return s.db.RefundRateLimitToken(ctx, database.RefundRateLimitTokenParams{
+		IntervalSeconds: interval.Seconds(),
+		Key:             key,
+	})
+}
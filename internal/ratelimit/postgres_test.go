@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+func TestPostgresStore_Take(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	store := NewPostgresStore(database.New(db))
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	maxTAT := now.Add(time.Minute)
+
+	// the first request prunes full buckets, the next one within the prune interval does not
+	mock.ExpectExec("DELETE FROM rate_limits").
+		WithArgs(now).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectQuery("INSERT INTO rate_limits").
+		WithArgs("login:192.0.2.1", now, float64(30), maxTAT).
+		WillReturnRows(sqlmock.NewRows([]string{"tat"}).AddRow(now.Add(30 * time.Second)))
+	// a rejected request leaves the bucket unchanged, its TAT is read to tell when to retry
+	mock.ExpectQuery("INSERT INTO rate_limits").
+		WithArgs("login:192.0.2.1", now, float64(30), maxTAT).
+		WillReturnRows(sqlmock.NewRows([]string{"tat"}))
+	mock.ExpectQuery("SELECT tat FROM rate_limits").
+		WithArgs("login:192.0.2.1").
+		WillReturnRows(sqlmock.NewRows([]string{"tat"}).AddRow(maxTAT))
+
+	tat, allowed, err := store.Take(ctx, "login:192.0.2.1", now, 30*time.Second, maxTAT)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if !allowed || !tat.Equal(now.Add(30*time.Second)) {
+		t.Errorf("Take() = %s, %v, want an allowed request moving the TAT by the interval", tat, allowed)
+	}
+	tat, allowed, err = store.Take(ctx, "login:192.0.2.1", now, 30*time.Second, maxTAT)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if allowed || !tat.Equal(maxTAT) {
+		t.Errorf("Take() = %s, %v, want a rejected request reporting the current TAT", tat, allowed)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
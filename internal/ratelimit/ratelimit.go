@@ -0,0 +1,99 @@
+// Package ratelimit throttles requests with token buckets.
+//
+// Buckets are tracked with the generic cell rate algorithm (GCRA): instead of a token count and a
+// refill time, a bucket is a single "theoretical arrival time" (TAT), the moment it will be full again.
+// Every request moves the TAT one emission interval (Period / Requests) into the future, and requests
+// that would move it more than Period ahead of now are rejected. This behaves exactly like a bucket of
+// Requests tokens refilled at a constant rate, while letting stores update a bucket in a single step.
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/szmktk/chirpy/internal/expiry"
+)
+
+// Limit allows Requests per Period, in bursts of up to Requests.
+type Limit struct {
+	// Name identifies the limit, so buckets of different limits never mix.
+	Name string
+	// Requests is the bucket capacity.
+	Requests int
+	// Period is the time it takes an empty bucket to refill.
+	Period time.Duration
+}
+
+// interval is the time it takes to refill a single token.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Store keeps the TAT of buckets. The memory store suits a single instance,
+// the Postgres store shares buckets between replicas.
+type Store interface {
+	// Take moves the TAT of the bucket by interval, unless that would put it past maxTAT.
+	// A bucket seen for the first time starts full, with the TAT at now.
+	// Returns the resulting TAT and whether the request was allowed; on rejection the TAT is left unchanged.
+	Take(ctx context.Context, key string, now time.Time, interval time.Duration, maxTAT time.Time) (tat time.Time, allowed bool, err error)
+	// Refund moves the TAT of the bucket back by interval, giving back a token taken earlier.
+	Refund(ctx context.Context, key string, interval time.Duration) error
+}
+
+// Result describes the state of a bucket after a request.
+type Result struct {
+	// Allowed reports whether the request may proceed.
+	Allowed bool
+	// Limit is the bucket capacity.
+	Limit int
+	// Remaining is the number of requests that can still be made right away.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when the request was allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter applies limits to buckets kept in a Store.
+type Limiter struct {
+	store Store
+	now   func() time.Time
+}
+
+// New returns a limiter keeping buckets in the store.
+func New(store Store) *Limiter {
+	return &Limiter{store: store, now: expiry.Now}
+}
+
+// Allow takes a token from the bucket of the key under the given limit.
+func (l *Limiter) Allow(ctx context.Context, limit Limit, key string) (Result, error) {
+	now := l.now()
+	interval := limit.interval()
+	tat, allowed, err := l.store.Take(ctx, bucketKey(limit, key), now, interval, now.Add(limit.Period))
+	if err != nil {
+		return Result{}, err
+	}
+
+	reset := max(tat.Sub(now), 0)
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int((limit.Period - reset) / interval),
+		Reset:     reset,
+	}
+	if !allowed {
+		// the next request is allowed once the bucket has refilled a token
+		result.RetryAfter = max(reset+interval-limit.Period, 0)
+	}
+	return result, nil
+}
+
+// Refund gives back a token taken by Allow, for a request that was rejected by another limit.
+func (l *Limiter) Refund(ctx context.Context, limit Limit, key string) error {
+	return l.store.Refund(ctx, bucketKey(limit, key), limit.interval())
+}
+
+// bucketKey identifies the bucket of the key under the limit.
+func bucketKey(limit Limit, key string) string {
+	return limit.Name + ":" + key
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := New(NewMemoryStore())
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Name: "chirps:create", Requests: 3, Period: 3 * time.Minute}
+
+	allow := func(key string, wantAllowed bool, wantRemaining int, wantRetryAfter time.Duration) {
+		t.Helper()
+		result, err := limiter.Allow(ctx, limit, key)
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		if result.Allowed != wantAllowed || result.Remaining != wantRemaining || result.RetryAfter != wantRetryAfter {
+			t.Errorf("Allow() = %+v, want allowed %t, remaining %d, retry after %s", result, wantAllowed, wantRemaining, wantRetryAfter)
+		}
+		if result.Limit != 3 {
+			t.Errorf("expected limit 3, got %d", result.Limit)
+		}
+	}
+
+	// a full bucket allows a burst
+	allow("user:1", true, 2, 0)
+	allow("user:1", true, 1, 0)
+	allow("user:1", true, 0, 0)
+	allow("user:1", false, 0, time.Minute)
+
+	// other keys and limits have their own buckets
+	allow("user:2", true, 2, 0)
+	if result, _ := limiter.Allow(ctx, Limit{Name: "chirps:read", Requests: 3, Period: 3 * time.Minute}, "user:1"); !result.Allowed {
+		t.Error("expected another limit to not share the bucket")
+	}
+
+	// tokens are refilled at a constant rate
+	now = now.Add(30 * time.Second)
+	allow("user:1", false, 0, 30*time.Second)
+	now = now.Add(30 * time.Second)
+	allow("user:1", true, 0, 0)
+
+	// an idle bucket refills completely, but not beyond its capacity
+	now = now.Add(time.Hour)
+	allow("user:1", true, 2, 0)
+	result, _ := limiter.Allow(ctx, limit, "user:1")
+	if result.Reset != 2*time.Minute {
+		t.Errorf("expected the bucket to be full again in 2m, got %s", result.Reset)
+	}
+
+	// a refunded token can be taken again
+	if err := limiter.Refund(ctx, limit, "user:1"); err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	allow("user:1", true, 1, 0)
+}
+
+func TestMemoryStore_Prune(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, _, err := store.Take(ctx, "old", start, time.Second, start.Add(time.Minute)); err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	later := start.Add(time.Hour)
+	if _, _, err := store.Take(ctx, "new", later, time.Second, later.Add(time.Minute)); err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+
+	if _, ok := store.tats["old"]; ok {
+		t.Error("expected full buckets to be pruned")
+	}
+	if _, ok := store.tats["new"]; !ok {
+		t.Error("expected the new bucket to be kept")
+	}
+}
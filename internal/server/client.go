@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxUserAgentLength int = 512
+
+// clientIP returns the IP address of the client making the request.
+// X-Forwarded-For is only honored when the service is configured to run behind a trusted proxy,
+// since clients can set it to anything. Only the rightmost entry, appended by that proxy, is used:
+// the entries before it are sent by the client and can be forged.
+func (srv *Server) clientIP(r *http.Request) string {
+	if values := r.Header.Values("X-Forwarded-For"); srv.cfg.TrustProxyHeaders && len(values) > 0 {
+		forwarded := values[len(values)-1]
+		last := forwarded[strings.LastIndex(forwarded, ",")+1:]
+		if ip := net.ParseIP(strings.TrimSpace(last)); ip != nil {
+			return ip.String()
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// userAgent returns the User-Agent header of the request, truncated to a sane length.
+func userAgent(r *http.Request) string {
+	return truncateUTF8(r.UserAgent(), maxUserAgentLength)
+}
+
+// truncateUTF8 cuts s to at most n bytes at a rune boundary, so a multi-byte character is never split.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	end := n
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
+
+// deviceLabel derives a human readable description of a device, such as "Firefox on Linux", from its user agent.
+func deviceLabel(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		// Order matters: Edge and Opera user agents also mention Chrome, and Chrome mentions Safari.
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	platform := ""
+	for _, p := range []struct{ token, name string }{
+		// Order matters: Android user agents also mention Linux, and iOS ones mention Mac OS X.
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}
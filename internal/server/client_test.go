@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestDeviceLabel(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0", "Firefox on Linux"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"curl/8.8.0", "curl"},
+		{"", "Unknown device"},
+	}
+
+	for _, tt := range tests {
+		if got := deviceLabel(tt.userAgent); got != tt.want {
+			t.Errorf("deviceLabel(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		trustProxy   bool
+		forwardedFor string
+		want         string
+	}{
+		{name: "remote address", want: "192.0.2.1"},
+		{name: "untrusted forwarded header", forwardedFor: "203.0.113.7", want: "192.0.2.1"},
+		{name: "trusted forwarded header", trustProxy: true, forwardedFor: "203.0.113.7", want: "203.0.113.7"},
+		{name: "entries sent by the client are ignored", trustProxy: true, forwardedFor: "198.51.100.9, 203.0.113.7", want: "203.0.113.7"},
+		{name: "malformed forwarded header", trustProxy: true, forwardedFor: "unknown", want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &Server{cfg: &config.Config{TrustProxyHeaders: tt.trustProxy}}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if got := srv.clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "short", userAgent: "curl/8.8.0", want: "curl/8.8.0"},
+		{name: "truncated", userAgent: strings.Repeat("a", maxUserAgentLength+10), want: strings.Repeat("a", maxUserAgentLength)},
+		// "é" is two bytes long and would be split at the limit
+		{name: "truncated at a rune boundary", userAgent: strings.Repeat("a", maxUserAgentLength-1) + "é", want: strings.Repeat("a", maxUserAgentLength-1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			got := userAgent(req)
+			if got != tt.want {
+				t.Errorf("userAgent() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("userAgent() = %q is not valid UTF-8", got)
+			}
+		})
+	}
+}
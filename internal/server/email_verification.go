@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/mail"
+)
+
+const emailVerificationTokenTTL = 24 * time.Hour
+
+// sendVerificationEmail issues a new verification token for the current email of the user
+// and mails it to them. Tokens issued earlier are invalidated.
+func (srv *Server) sendVerificationEmail(ctx context.Context, user database.User) error {
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("generating verification token: %w", err)
+	}
+
+	if err := srv.db.InvalidateEmailVerificationTokens(ctx, user.ID); err != nil {
+		return fmt.Errorf("invalidating previous verification tokens: %w", err)
+	}
+	err = srv.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationTokenTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("storing verification token: %w", err)
+	}
+
+	body := fmt.Sprintf("Welcome to Chirpy!\n\nUse the following token to verify your email address: %s\n", token)
+	if srv.cfg.BaseURL != "" {
+		body = fmt.Sprintf("Welcome to Chirpy!\n\nOpen the following link to verify your email address:\n%s/verify?token=%s\n", srv.cfg.BaseURL, token)
+	}
+	body += fmt.Sprintf("\nThe token expires in %s.\n", emailVerificationTokenTTL)
+
+	return srv.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body:    body,
+	})
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+// Feature is a premium feature granted by subscription plans.
+type Feature string
+
+const (
+	// FeatureLongChirps allows chirps of up to maxLongChirpLength characters.
+	FeatureLongChirps Feature = "long_chirps"
+	// FeatureChirpEditing allows editing posted chirps.
+	FeatureChirpEditing Feature = "chirp_editing"
+	// FeatureHigherRateLimits multiplies the rate limits of a user by premiumRateLimitFactor.
+	FeatureHigherRateLimits Feature = "higher_rate_limits"
+)
+
+// freePlan is the plan of users without an active subscription.
+const freePlan = "free"
+
+var featureDescriptions = map[Feature]string{
+	FeatureLongChirps:       fmt.Sprintf("chirps longer than %d characters", maxChirpLength),
+	FeatureChirpEditing:     "editing chirps",
+	FeatureHigherRateLimits: "higher rate limits",
+}
+
+// defaultPlanFeatures is the plan to feature matrix used unless configured otherwise.
+var defaultPlanFeatures = map[string][]string{
+	freePlan:                {},
+	defaultSubscriptionPlan: {string(FeatureLongChirps), string(FeatureChirpEditing), string(FeatureHigherRateLimits)},
+}
+
+// Entitlements are the premium features available to a user.
+type Entitlements struct {
+	Plan     string
+	features map[Feature]bool
+}
+
+// Has reports whether the feature is available.
+func (e Entitlements) Has(feature Feature) bool {
+	return e.features[feature]
+}
+
+// newPlanFeatures validates the configured plan to feature matrix, falling back to defaultPlanFeatures.
+func newPlanFeatures(cfg *config.Config) (map[string]map[Feature]bool, error) {
+	matrix := cfg.PlanFeatures
+	if matrix == nil {
+		matrix = defaultPlanFeatures
+	}
+	planFeatures := make(map[string]map[Feature]bool, len(matrix))
+	for plan, features := range matrix {
+		planFeatures[plan] = make(map[Feature]bool, len(features))
+		for _, feature := range features {
+			if _, ok := featureDescriptions[Feature(feature)]; !ok {
+				return nil, fmt.Errorf("unknown feature %q of plan %q", feature, plan)
+			}
+			planFeatures[plan][Feature(feature)] = true
+		}
+	}
+	return planFeatures, nil
+}
+
+// entitlements returns the features of the plan the user is subscribed to. Subscriptions to a plan
+// missing from the matrix get the features of the default plan, users without one those of the free plan.
+func (srv *Server) entitlements(ctx context.Context, userID uuid.UUID) (Entitlements, error) {
+	free := Entitlements{Plan: freePlan, features: srv.planFeatures[freePlan]}
+
+	subscription, err := srv.db.GetActiveSubscription(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return free, nil
+		}
+		return free, err
+	}
+
+	features, ok := srv.planFeatures[subscription.Plan]
+	if !ok {
+		features = srv.planFeatures[defaultSubscriptionPlan]
+	}
+	return Entitlements{Plan: subscription.Plan, features: features}, nil
+}
+
+// requireFeature returns a 402 APIError when the user's plan lacks a feature another plan grants,
+// or a 403 APIError when no plan grants it.
+func (srv *Server) requireFeature(ctx context.Context, userID uuid.UUID, feature Feature) error {
+	entitlements, err := srv.entitlements(ctx, userID)
+	if err != nil {
+		srv.logger.Error("Error getting entitlements", "user_id", userID, "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if entitlements.Has(feature) {
+		return nil
+	}
+
+	for _, features := range srv.planFeatures {
+		if features[feature] {
+			return APIError{Status: http.StatusPaymentRequired, Msg: "A Chirpy Red subscription is required for " + featureDescriptions[feature]}
+		}
+	}
+	return APIError{Status: http.StatusForbidden, Msg: fmt.Sprintf("Feature %q is not available", feature)}
+}
+
+// RequireFeature rejects requests of users whose plan lacks the feature. It must run after authentication.
+func (srv *Server) RequireFeature(next apiFunc, feature Feature) apiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userID, ok := r.Context().Value(contextKeyUserID).(uuid.UUID)
+		if !ok {
+			return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+		}
+		if err := srv.requireFeature(r.Context(), userID, feature); err != nil {
+			return err
+		}
+		return next(w, r)
+	}
+}
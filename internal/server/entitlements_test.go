@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+var subscriptionColumns = []string{"id", "user_id", "plan", "status", "current_period_start", "current_period_end", "canceled_at", "created_at", "updated_at"}
+
+func mockSubscriptionRow(userID uuid.UUID, plan string) []driver.Value {
+	return []driver.Value{uuid.New(), userID, plan, "active", time.Now(), time.Now().AddDate(0, 1, 0), nil, time.Now(), time.Now()}
+}
+
+func TestRequireFeature(t *testing.T) {
+	tests := []struct {
+		name           string
+		planFeatures   map[string][]string
+		plan           string
+		feature        Feature
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:    "subscribed",
+			plan:    "chirpy_red",
+			feature: FeatureChirpEditing,
+		},
+		{
+			name:           "free plan",
+			feature:        FeatureChirpEditing,
+			expectedStatus: http.StatusPaymentRequired,
+			expectedError:  "A Chirpy Red subscription is required for editing chirps",
+		},
+		{
+			name:    "plan missing from the matrix",
+			plan:    "chirpy_red_yearly",
+			feature: FeatureLongChirps,
+		},
+		{
+			name:         "configured plans",
+			planFeatures: map[string][]string{"free": {"long_chirps"}, "chirpy_red": {"long_chirps", "chirp_editing"}},
+			feature:      FeatureLongChirps,
+		},
+		{
+			name:           "not granted by any plan",
+			planFeatures:   map[string][]string{"chirpy_red": {"long_chirps"}},
+			plan:           "chirpy_red",
+			feature:        FeatureChirpEditing,
+			expectedStatus: http.StatusForbidden,
+			expectedError:  `Feature "chirp_editing" is not available`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{PlanFeatures: tt.planFeatures}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID := uuid.New()
+			query := mock.ExpectQuery("SELECT (.+) FROM subscriptions").WithArgs(userID)
+			if tt.plan == "" {
+				query.WillReturnError(sql.ErrNoRows)
+			} else {
+				query.WillReturnRows(sqlmock.NewRows(subscriptionColumns).AddRow(mockSubscriptionRow(userID, tt.plan)...))
+			}
+
+			called := false
+			handler := srv.RequireFeature(func(w http.ResponseWriter, r *http.Request) error {
+				called = true
+				respondWithNoContent(w)
+				return nil
+			}, tt.feature)
+			req := httptest.NewRequest(http.MethodPut, "/api/chirps/"+uuid.NewString(), nil)
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+			err = handler(httptest.NewRecorder(), req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+				if called {
+					t.Error("expected the handler to not be called")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !called {
+					t.Error("expected the handler to be called")
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewServer_UnknownPlanFeature(t *testing.T) {
+	cfg := &config.Config{PlanFeatures: map[string][]string{"chirpy_red": {"scheduled_posts"}}}
+	_, err := NewServer(cfg, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil || err.Error() != `unknown feature "scheduled_posts" of plan "chirpy_red"` {
+		t.Errorf("expected unknown feature error, got %v", err)
+	}
+}
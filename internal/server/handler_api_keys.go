@@ -0,0 +1,173 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+const (
+	maxAPIKeyNameLength int   = 100
+	maxActiveAPIKeys    int64 = 25
+)
+
+// APIKey describes a personal API key. The key itself is only returned once, when it is created.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// CreateAPIKey issues a personal API key, used with the "Authorization: ApiKey <key>" header
+// by bots and scripts in place of logging in. Keys never expire unless expires_in_days is given.
+func (srv *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	payload := input{}
+	err := decoder.Decode(&payload)
+	if err != nil {
+		srv.logger.Error("Error decoding JSON body", "err", err)
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		return APIError{Status: http.StatusBadRequest, Msg: "Name cannot be empty"}
+	}
+	if utf8.RuneCountInString(name) > maxAPIKeyNameLength {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Name cannot be longer than %d characters", maxAPIKeyNameLength)}
+	}
+	if err := validateDelegatedScopes(payload.Scopes); err != nil {
+		return err
+	}
+	if payload.ExpiresInDays < 0 {
+		return APIError{Status: http.StatusBadRequest, Msg: "Expiration must be a positive number of days"}
+	}
+
+	active, err := srv.db.CountActiveAPIKeys(r.Context(), parsedUserID)
+	if err != nil {
+		srv.logger.Error("Error counting API keys", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if active >= maxActiveAPIKeys {
+		return APIError{Status: http.StatusConflict, Msg: fmt.Sprintf("Cannot have more than %d API keys, revoke unused ones first", maxActiveAPIKeys)}
+	}
+
+	key, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		srv.logger.Error("Error generating API key", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	var expiresAt sql.NullTime
+	if payload.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().UTC().AddDate(0, 0, payload.ExpiresInDays), Valid: true}
+	}
+
+	apiKey, err := srv.db.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:    parsedUserID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashToken(key),
+		Scopes:    payload.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		srv.logger.Error("Error creating API key", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	srv.logger.Info("Created API key", "user_id", parsedUserID, "key_id", apiKey.ID, "scopes", apiKey.Scopes)
+	created := mapDbAPIKey(apiKey)
+	created.Key = key
+	return respondWithJSON(w, http.StatusCreated, created)
+}
+
+func (srv *Server) GetAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	dbKeys, err := srv.db.ListAPIKeys(r.Context(), parsedUserID)
+	if err != nil {
+		srv.logger.Error("Error listing API keys", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	keys := make([]APIKey, 0, len(dbKeys))
+	for _, dbKey := range dbKeys {
+		keys = append(keys, mapDbAPIKey(dbKey))
+	}
+	return respondWithJSON(w, http.StatusOK, keys)
+}
+
+func (srv *Server) RevokeAPIKey(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	revoked, err := srv.db.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{
+		ID:     keyID,
+		UserID: parsedUserID,
+	})
+	if err != nil {
+		srv.logger.Error("Error revoking API key", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if revoked == 0 {
+		return APIError{Status: http.StatusNotFound, Msg: "API key with given id has not been found"}
+	}
+
+	respondWithNoContent(w)
+	return nil
+}
+
+func mapDbAPIKey(dbKey database.ApiKey) APIKey {
+	key := APIKey{
+		ID:        dbKey.ID,
+		Name:      dbKey.Name,
+		Prefix:    dbKey.Prefix,
+		Scopes:    dbKey.Scopes,
+		CreatedAt: dbKey.CreatedAt,
+	}
+	if dbKey.ExpiresAt.Valid {
+		key.ExpiresAt = &dbKey.ExpiresAt.Time
+	}
+	if dbKey.LastUsedAt.Valid {
+		key.LastUsedAt = &dbKey.LastUsedAt.Time
+	}
+	return key
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	apiKeyColumns := []string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "created_at", "expires_at", "last_used_at", "revoked_at"}
+
+	tests := []struct {
+		name           string
+		body           string
+		activeKeys     int64
+		expectCount    bool
+		expectInsert   bool
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "happy path",
+			body:           `{"name": "CI", "scopes": ["chirps:write"], "expires_in_days": 90}`,
+			expectCount:    true,
+			expectInsert:   true,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "empty name",
+			body:           `{"name": " ", "scopes": ["chirps:write"]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Name cannot be empty",
+		},
+		{
+			name:           "account management",
+			body:           `{"name": "CI", "scopes": ["account:manage"]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `Scope "account:manage" cannot be delegated`,
+		},
+		{
+			name:           "negative expiration",
+			body:           `{"name": "CI", "scopes": ["chirps:write"], "expires_in_days": -1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Expiration must be a positive number of days",
+		},
+		{
+			name:           "too many keys",
+			body:           `{"name": "CI", "scopes": ["chirps:write"]}`,
+			activeKeys:     25,
+			expectCount:    true,
+			expectedStatus: http.StatusConflict,
+			expectedError:  "Cannot have more than 25 API keys, revoke unused ones first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID := uuid.New()
+			if tt.expectCount {
+				mock.ExpectQuery("SELECT COUNT").
+					WithArgs(userID).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.activeKeys))
+			}
+			if tt.expectInsert {
+				mock.ExpectQuery("INSERT INTO api_keys").
+					WithArgs(userID, "CI", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+						AddRow(uuid.New(), userID, "CI", "chirpy_12345678", "hash", "{chirps:write}", time.Now(), time.Now().AddDate(0, 0, 90), nil, nil))
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+			w := httptest.NewRecorder()
+			err = srv.CreateAPIKey(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+				var created APIKey
+				if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if !strings.HasPrefix(created.Key, "chirpy_") {
+					t.Errorf("expected the new key to be returned, got %q", created.Key)
+				}
+				if len(created.Scopes) != 1 || created.Scopes[0] != "chirps:write" || created.ExpiresAt == nil {
+					t.Errorf("unexpected key %+v", created)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
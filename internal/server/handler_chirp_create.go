@@ -1,17 +1,24 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
 )
 
 const maxChirpLength int = 140
 
+// maxLongChirpLength is the chirp length allowed to users with the long chirps feature.
+const maxLongChirpLength int = 1000
+
 var forbiddenWords = map[string]bool{
 	"kerfuffle": true,
 	"sharbert":  true,
@@ -19,16 +26,20 @@ var forbiddenWords = map[string]bool{
 }
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	InReplyTo *uuid.UUID `json:"in_reply_to,omitempty"`
+	LikeCount int64      `json:"like_count"`
+	LikedByMe *bool      `json:"liked_by_me,omitempty"`
 }
 
 func (srv *Server) CreateChirp(w http.ResponseWriter, r *http.Request) error {
 	type input struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
 	}
 
 	ctxVal := r.Context().Value(contextKeyUserID)
@@ -45,28 +56,70 @@ func (srv *Server) CreateChirp(w http.ResponseWriter, r *http.Request) error {
 		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
 
-	if len(payload.Body) > maxChirpLength {
-		return APIError{Status: http.StatusBadRequest, Msg: "Chirp is too long"}
+	if srv.cfg.RequireVerifiedEmail {
+		user, err := srv.db.GetUserByID(r.Context(), parsedUserID)
+		if err != nil {
+			srv.logger.Error("Error getting user", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		if !user.EmailVerifiedAt.Valid {
+			return APIError{Status: http.StatusForbidden, Msg: "Email must be verified before posting chirps"}
+		}
+	}
+
+	cleanedBody, err := srv.validateChirpBody(r.Context(), parsedUserID, payload.Body)
+	if err != nil {
+		return err
 	}
 
-	cleanedBody := sanitizeInput(payload.Body)
+	inReplyTo := uuid.NullUUID{}
+	if payload.InReplyTo != nil {
+		if _, err := srv.db.GetChirp(r.Context(), *payload.InReplyTo); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return APIError{Status: http.StatusBadRequest, Msg: "Chirp being replied to has not been found"}
+			}
+			srv.logger.Error("Error getting parent chirp", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		inReplyTo = uuid.NullUUID{UUID: *payload.InReplyTo, Valid: true}
+	}
 
-	chirp, err := srv.db.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   cleanedBody,
-		UserID: parsedUserID,
+	var chirp database.Chirp
+	err = srv.withTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		chirp, err = q.CreateChirp(r.Context(), database.CreateChirpParams{
+			Body:      cleanedBody,
+			UserID:    parsedUserID,
+			InReplyTo: inReplyTo,
+		})
+		if err != nil {
+			return err
+		}
+		return events.Record(r.Context(), q, events.ChirpCreated, parsedUserID, mapDbChirp(chirp))
 	})
 	if err != nil {
 		srv.logger.Error("Error creating chirp", "err", err)
 		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
 
-	return respondWithJSON(w, http.StatusCreated, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	})
+	response := mapDbChirp(chirp)
+	likedByMe := false
+	response.LikedByMe = &likedByMe
+	return respondWithJSON(w, http.StatusCreated, response)
+}
+
+// validateChirpBody checks the chirp length and returns the body with forbidden words masked.
+// Chirps longer than maxChirpLength require the long chirps feature.
+func (srv *Server) validateChirpBody(ctx context.Context, userID uuid.UUID, body string) (string, error) {
+	if len(body) > maxLongChirpLength {
+		return "", APIError{Status: http.StatusBadRequest, Msg: "Chirp is too long"}
+	}
+	if len(body) > maxChirpLength {
+		if err := srv.requireFeature(ctx, userID, FeatureLongChirps); err != nil {
+			return "", err
+		}
+	}
+	return sanitizeInput(body), nil
 }
 
 func sanitizeInput(body string) string {
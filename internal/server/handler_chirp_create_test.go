@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"io"
 	"log/slog"
@@ -14,13 +15,14 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"github.com/szmktk/chirpy/internal/config"
-	"github.com/szmktk/chirpy/internal/database"
 )
 
 func TestCreateChirp(t *testing.T) {
 	tests := []struct {
 		name           string
 		userID         uuid.UUID
+		unverified     bool
+		plan           string
 		requestBody    string
 		expectedStatus int
 		expectedError  string
@@ -53,19 +55,43 @@ func TestCreateChirp(t *testing.T) {
 			expectedStatus: http.StatusInternalServerError,
 			expectedError:  "Internal Server Error",
 		},
+		{
+			name:           "unverified email",
+			userID:         uuid.New(),
+			unverified:     true,
+			requestBody:    `{"body": "Hello world!"}`,
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "Email must be verified before posting chirps",
+		},
 		{
 			name:           "chirp too long",
 			userID:         uuid.New(),
-			requestBody:    `{"body": "` + strings.Repeat("a", maxChirpLength+1) + `"}`,
+			requestBody:    `{"body": "` + strings.Repeat("a", maxLongChirpLength+1) + `"}`,
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "Chirp is too long",
 		},
+		{
+			name:           "long chirp on the free plan",
+			userID:         uuid.New(),
+			plan:           "free",
+			requestBody:    `{"body": "` + strings.Repeat("a", maxChirpLength+1) + `"}`,
+			expectedStatus: http.StatusPaymentRequired,
+			expectedError:  "A Chirpy Red subscription is required for chirps longer than 140 characters",
+		},
+		{
+			name:           "long chirp with Chirpy Red",
+			userID:         uuid.New(),
+			plan:           "chirpy_red",
+			requestBody:    `{"body": "` + strings.Repeat("a", maxChirpLength+1) + `"}`,
+			expectedStatus: http.StatusCreated,
+			wantBody:       strings.Repeat("a", maxChirpLength+1),
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Setup
-			cfg := &config.Config{}
+			cfg := &config.Config{RequireVerifiedEmail: tt.unverified}
 			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 			db, mock, err := sqlmock.New()
 			if err != nil {
@@ -73,8 +99,7 @@ func TestCreateChirp(t *testing.T) {
 			}
 			defer db.Close()
 
-			queries := database.New(db)
-			srv, err := NewServer(cfg, queries, logger)
+			srv, err := NewServer(cfg, db, logger)
 			if err != nil {
 				t.Fatalf("failed to create server: %v", err)
 			}
@@ -82,20 +107,39 @@ func TestCreateChirp(t *testing.T) {
 			// Create request
 			req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(tt.requestBody))
 
+			if tt.plan != "" {
+				query := mock.ExpectQuery("SELECT (.+) FROM subscriptions").WithArgs(tt.userID)
+				if tt.plan == "free" {
+					query.WillReturnError(sql.ErrNoRows)
+				} else {
+					query.WillReturnRows(sqlmock.NewRows(subscriptionColumns).AddRow(mockSubscriptionRow(tt.userID, tt.plan)...))
+				}
+			}
+
 			// Only set up mock expectations for the happy path
 			if tt.userID != uuid.Nil && tt.expectedError == "" {
 				ctx := context.WithValue(req.Context(), contextKeyUserID, tt.userID)
 				req = req.WithContext(ctx)
 
 				// Setup mock DB expectations for successful case
+				mock.ExpectBegin()
 				mock.ExpectQuery("INSERT INTO chirps").
-					WithArgs(tt.wantBody, tt.userID).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "body", "user_id"}).
-						AddRow(uuid.New(), time.Now(), time.Now(), tt.wantBody, tt.userID))
+					WithArgs(tt.wantBody, tt.userID, uuid.NullUUID{}).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "body", "user_id", "in_reply_to", "deleted_at"}).
+						AddRow(uuid.New(), time.Now(), time.Now(), tt.wantBody, tt.userID, nil, nil))
+				mock.ExpectExec("INSERT INTO outbox").
+					WithArgs(sqlmock.AnyArg(), "chirp.created", tt.userID, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 			} else if tt.userID != uuid.Nil {
 				ctx := context.WithValue(req.Context(), contextKeyUserID, tt.userID)
 				req = req.WithContext(ctx)
 			}
+			if tt.unverified {
+				mock.ExpectQuery("SELECT (.+) FROM users").
+					WithArgs(tt.userID).
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(mockUserRow(tt.userID, "alice@example.com", "hash")...))
+			}
 
 			// Execute request
 			w := httptest.NewRecorder()
@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
 )
 
 func (srv *Server) DeleteChirp(w http.ResponseWriter, r *http.Request) error {
@@ -30,7 +32,13 @@ func (srv *Server) DeleteChirp(w http.ResponseWriter, r *http.Request) error {
 		return APIError{Status: http.StatusForbidden, Msg: "Deleting chirps of other users is not allowed"}
 	}
 
-	if err := srv.db.DeleteChirp(r.Context(), chirpUUID); err != nil {
+	err = srv.withTx(r.Context(), func(q *database.Queries) error {
+		if err := q.DeleteChirp(r.Context(), chirpUUID); err != nil {
+			return err
+		}
+		return events.Record(r.Context(), q, events.ChirpDeleted, parsedUserID, mapDbChirp(dbChirp))
+	})
+	if err != nil {
 		srv.logger.Error("Error deleting chirp", "err", err)
 		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
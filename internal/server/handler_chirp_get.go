@@ -9,43 +9,59 @@ import (
 	"github.com/szmktk/chirpy/internal/database"
 )
 
+// ChirpPage is a single page of chirps along with the cursor pointing at the next one.
+type ChirpPage struct {
+	Chirps     []Chirp `json:"chirps"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
 func (srv *Server) GetAllChirps(w http.ResponseWriter, r *http.Request) error {
-	ordering := strings.ToLower(r.URL.Query().Get("sort"))
-	authorID := r.URL.Query().Get("author_id")
-	if authorID == "" {
-		srv.logger.Info("Getting all chirps stored in the database")
-		dbChirps, err := srv.db.GetAllChirps(r.Context())
-		if err != nil {
-			srv.logger.Error("Error getting all chirps", "err", err)
-			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
-		}
-		if ordering == "desc" {
-			reverse(dbChirps)
-			return respondWithJSON(w, http.StatusOK, mapDbChirps(dbChirps))
-		}
-
-		return respondWithJSON(w, http.StatusOK, mapDbChirps(dbChirps))
+	descending := strings.ToLower(r.URL.Query().Get("sort")) == "desc"
 
+	authorID, err := parseAuthorID(r)
+	if err != nil {
+		return err
 	}
 
-	authorUUID, err := uuid.Parse(authorID)
+	page, err := parsePageParams(r)
 	if err != nil {
-		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+		return err
 	}
+	cursorCreatedAt, cursorID := page.cursorArgs()
 
-	srv.logger.Info("Getting all chirps for user", "user_id", authorUUID)
-	dbChirps, err := srv.db.GetAllChirpsForUser(r.Context(), authorUUID)
+	srv.logger.Info("Getting chirps", "author_id", authorID.UUID, "limit", page.Limit, "desc", descending)
+	var dbChirps []database.Chirp
+	if descending {
+		dbChirps, err = srv.db.ListChirpsDescending(r.Context(), database.ListChirpsDescendingParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        page.rowLimit(),
+		})
+	} else {
+		dbChirps, err = srv.db.ListChirpsAscending(r.Context(), database.ListChirpsAscendingParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        page.rowLimit(),
+		})
+	}
 	if err != nil {
-		srv.logger.Error("Error getting all user chirps", "err", err)
+		srv.logger.Error("Error getting chirps", "err", err)
 		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
 
-	if ordering == "desc" {
-		reverse(dbChirps)
-		return respondWithJSON(w, http.StatusOK, mapDbChirps(dbChirps))
-
+	dbChirps, nextCursor := paginate(dbChirps, page, chirpCursor)
+	chirps := mapDbChirps(dbChirps)
+	if err := srv.withLikeStats(r.Context(), chirpRefs(chirps)...); err != nil {
+		srv.logger.Error("Error getting chirp likes", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
-	return respondWithJSON(w, http.StatusOK, mapDbChirps(dbChirps))
+
+	return respondWithJSON(w, http.StatusOK, ChirpPage{
+		Chirps:     chirps,
+		NextCursor: nextCursor,
+	})
 }
 
 func (srv *Server) GetChirp(w http.ResponseWriter, r *http.Request) error {
@@ -61,32 +77,52 @@ func (srv *Server) GetChirp(w http.ResponseWriter, r *http.Request) error {
 		return APIError{Status: http.StatusNotFound, Msg: "Chirp with given id has not been found"}
 	}
 
+	chirp := mapDbChirp(dbChirp)
+	if err := srv.withLikeStats(r.Context(), &chirp); err != nil {
+		srv.logger.Error("Error getting chirp likes", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
 	srv.logger.Info("Getting details of chirp", "id", chirpUUID)
-	return respondWithJSON(w, http.StatusOK, Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body:      dbChirp.Body,
-		UserID:    dbChirp.UserID,
-	})
+	return respondWithJSON(w, http.StatusOK, chirp)
+}
+
+func mapDbChirp(c database.Chirp) Chirp {
+	chirp := Chirp{
+		ID:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body:      c.Body,
+		UserID:    c.UserID,
+	}
+	if c.InReplyTo.Valid {
+		chirp.InReplyTo = &c.InReplyTo.UUID
+	}
+	return chirp
 }
 
 func mapDbChirps(entities []database.Chirp) []Chirp {
 	chirps := make([]Chirp, 0)
 	for _, c := range entities {
-		chirps = append(chirps, Chirp{
-			ID:        c.ID,
-			CreatedAt: c.CreatedAt,
-			UpdatedAt: c.UpdatedAt,
-			Body:      c.Body,
-			UserID:    c.UserID,
-		})
+		chirps = append(chirps, mapDbChirp(c))
 	}
 	return chirps
 }
 
-func reverse(records []database.Chirp) {
-	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
-		records[i], records[j] = records[j], records[i]
+// parseAuthorID reads the optional `author_id` query parameter.
+func parseAuthorID(r *http.Request) (uuid.NullUUID, error) {
+	authorID := r.URL.Query().Get("author_id")
+	if authorID == "" {
+		return uuid.NullUUID{}, nil
 	}
+
+	authorUUID, err := uuid.Parse(authorID)
+	if err != nil {
+		return uuid.NullUUID{}, APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+	return uuid.NullUUID{UUID: authorUUID, Valid: true}, nil
+}
+
+func chirpCursor(c database.Chirp) pageCursor {
+	return pageCursor{CreatedAt: c.CreatedAt, ID: c.ID}
 }
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestGetAllChirps(t *testing.T) {
+	userID := uuid.New()
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	chirpIDs := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectQuery    string
+		rows           int
+		expectedStatus int
+		expectedError  string
+		wantChirps     int
+		wantNextCursor bool
+	}{
+		{
+			name:           "first page with more results",
+			query:          "?limit=2",
+			expectQuery:    "ORDER BY created_at ASC",
+			rows:           3,
+			expectedStatus: http.StatusOK,
+			wantChirps:     2,
+			wantNextCursor: true,
+		},
+		{
+			name:           "last page",
+			query:          "?limit=3&sort=desc",
+			expectQuery:    "ORDER BY created_at DESC",
+			rows:           3,
+			expectedStatus: http.StatusOK,
+			wantChirps:     3,
+		},
+		{
+			name:           "continue from cursor",
+			query:          "?cursor=" + encodeCursor(pageCursor{CreatedAt: base, ID: chirpIDs[0]}),
+			expectQuery:    "ORDER BY created_at ASC",
+			rows:           1,
+			expectedStatus: http.StatusOK,
+			wantChirps:     1,
+		},
+		{
+			name:           "invalid limit",
+			query:          "?limit=0",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Limit must be a number between 1 and 100",
+		},
+		{
+			name:           "invalid cursor",
+			query:          "?cursor=not-a-cursor",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid cursor",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			if tt.expectQuery != "" {
+				rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "body", "user_id", "in_reply_to", "deleted_at"})
+				for i := 0; i < tt.rows; i++ {
+					createdAt := base.Add(time.Duration(i) * time.Minute)
+					rows.AddRow(chirpIDs[i], createdAt, createdAt, "chirp", userID, nil, nil)
+				}
+				mock.ExpectQuery(tt.expectQuery).WillReturnRows(rows)
+				mock.ExpectQuery("FROM chirp_likes").
+					WillReturnRows(sqlmock.NewRows([]string{"chirp_id", "like_count", "liked_by_me"}).
+						AddRow(chirpIDs[0], 3, false))
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps"+tt.query, nil)
+			w := httptest.NewRecorder()
+			err = srv.GetAllChirps(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var response ChirpPage
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(response.Chirps) != tt.wantChirps {
+				t.Errorf("expected %d chirps, got %d", tt.wantChirps, len(response.Chirps))
+			}
+			for _, c := range response.Chirps {
+				wantLikes := int64(0)
+				if c.ID == chirpIDs[0] {
+					wantLikes = 3
+				}
+				if c.LikeCount != wantLikes {
+					t.Errorf("expected chirp %v to have %d likes, got %d", c.ID, wantLikes, c.LikeCount)
+				}
+				if c.LikedByMe != nil {
+					t.Errorf("expected liked_by_me to be omitted for anonymous requests")
+				}
+			}
+			if (response.NextCursor != "") != tt.wantNextCursor {
+				t.Errorf("expected next cursor presence %v, got %q", tt.wantNextCursor, response.NextCursor)
+			}
+			if tt.wantNextCursor {
+				cursor, err := decodeCursor(response.NextCursor)
+				if err != nil {
+					t.Fatalf("failed to decode next cursor: %v", err)
+				}
+				last := response.Chirps[len(response.Chirps)-1]
+				if cursor.ID != last.ID || !cursor.CreatedAt.Equal(last.CreatedAt) {
+					t.Errorf("expected cursor to point at the last chirp %v, got %v", last.ID, cursor.ID)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+func (srv *Server) LikeChirp(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, err := uuid.Parse(chirpID)
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	chirp, err := srv.db.GetChirp(r.Context(), chirpUUID)
+	if err != nil {
+		srv.logger.Info("Chirp not found", "err", err)
+		return APIError{Status: http.StatusNotFound, Msg: "Chirp with given id has not been found"}
+	}
+
+	err = srv.withTx(r.Context(), func(q *database.Queries) error {
+		liked, err := q.LikeChirp(r.Context(), database.LikeChirpParams{
+			ChirpID: chirpUUID,
+			UserID:  parsedUserID,
+		})
+		if err != nil || liked == 0 {
+			return err
+		}
+		return events.Record(r.Context(), q, events.ChirpLiked, chirp.UserID, map[string]uuid.UUID{
+			"chirp_id": chirp.ID,
+			"user_id":  parsedUserID,
+		})
+	})
+	if err != nil {
+		srv.logger.Error("Error liking chirp", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	respondWithNoContent(w)
+	return nil
+}
+
+func (srv *Server) UnlikeChirp(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, err := uuid.Parse(chirpID)
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	err = srv.db.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		ChirpID: chirpUUID,
+		UserID:  parsedUserID,
+	})
+	if err != nil {
+		srv.logger.Error("Error unliking chirp", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	respondWithNoContent(w)
+	return nil
+}
+
+// withLikeStats fills in like counts for the given chirps using a single query.
+// When the request is authenticated it also reports whether the caller liked each chirp.
+func (srv *Server) withLikeStats(ctx context.Context, chirps ...*Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	viewerID, authenticated := ctx.Value(contextKeyUserID).(uuid.UUID)
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for _, c := range chirps {
+		chirpIDs = append(chirpIDs, c.ID)
+	}
+
+	stats, err := srv.db.GetChirpLikeStats(ctx, database.GetChirpLikeStatsParams{
+		ViewerID: uuid.NullUUID{UUID: viewerID, Valid: authenticated},
+		ChirpIds: chirpIDs,
+	})
+	if err != nil {
+		return err
+	}
+
+	byChirp := make(map[uuid.UUID]database.GetChirpLikeStatsRow, len(stats))
+	for _, s := range stats {
+		byChirp[s.ChirpID] = s
+	}
+	for _, c := range chirps {
+		s := byChirp[c.ID]
+		c.LikeCount = s.LikeCount
+		if authenticated {
+			likedByMe := s.LikedByMe
+			c.LikedByMe = &likedByMe
+		}
+	}
+	return nil
+}
+
+// chirpRefs returns pointers to the elements of chirps so they can be updated in place.
+func chirpRefs(chirps []Chirp) []*Chirp {
+	refs := make([]*Chirp, 0, len(chirps))
+	for i := range chirps {
+		refs = append(refs, &chirps[i])
+	}
+	return refs
+}
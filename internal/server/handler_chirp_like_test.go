@@ -0,0 +1,273 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+func TestLikeChirp(t *testing.T) {
+	userID := uuid.New()
+	authorID := uuid.New()
+	chirpID := uuid.New()
+
+	tests := []struct {
+		name           string
+		chirpID        string
+		setupMock      func(mock sqlmock.Sqlmock)
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:    "like",
+			chirpID: chirpID.String(),
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM chirps").
+					WithArgs(chirpID).
+					WillReturnRows(sqlmock.NewRows(chirpColumns).AddRow(chirpID, time.Now(), time.Now(), "hello", authorID, nil, nil))
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO chirp_likes").
+					WithArgs(chirpID, userID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO outbox").
+					WithArgs(sqlmock.AnyArg(), events.ChirpLiked, authorID, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:    "liking twice records no event",
+			chirpID: chirpID.String(),
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM chirps").
+					WithArgs(chirpID).
+					WillReturnRows(sqlmock.NewRows(chirpColumns).AddRow(chirpID, time.Now(), time.Now(), "hello", authorID, nil, nil))
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO chirp_likes").
+					WithArgs(chirpID, userID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "invalid chirp id",
+			chirpID:        "not-a-uuid",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Error parsing UUID: invalid UUID length: 10",
+		},
+		{
+			name:    "unknown chirp",
+			chirpID: chirpID.String(),
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM chirps").
+					WithArgs(chirpID).
+					WillReturnRows(sqlmock.NewRows(chirpColumns))
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "Chirp with given id has not been found",
+		},
+		{
+			name:    "database error rolls back",
+			chirpID: chirpID.String(),
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM chirps").
+					WithArgs(chirpID).
+					WillReturnRows(sqlmock.NewRows(chirpColumns).AddRow(chirpID, time.Now(), time.Now(), "hello", authorID, nil, nil))
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO chirp_likes").
+					WithArgs(chirpID, userID).
+					WillReturnError(errors.New("connection reset"))
+				mock.ExpectRollback()
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "Internal Server Error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+			if tt.setupMock != nil {
+				tt.setupMock(mock)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps/"+tt.chirpID+"/likes", nil)
+			req.SetPathValue("chirpID", tt.chirpID)
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+			w := httptest.NewRecorder()
+			err = srv.LikeChirp(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnlikeChirp(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	userID := uuid.New()
+	chirpID := uuid.New()
+	// unliking a chirp that is not liked succeeds as well, so the request can be retried
+	for range 2 {
+		mock.ExpectExec("DELETE FROM chirp_likes").
+			WithArgs(chirpID, userID).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		req := httptest.NewRequest(http.MethodDelete, "/api/chirps/"+chirpID.String()+"/likes", nil)
+		req.SetPathValue("chirpID", chirpID.String())
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+		w := httptest.NewRecorder()
+		if err := srv.UnlikeChirp(w, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if w.Code != http.StatusNoContent {
+			t.Errorf("expected status %d, got %d", http.StatusNoContent, w.Code)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestWithLikeStats(t *testing.T) {
+	viewerID := uuid.New()
+	liked, popular, unliked := Chirp{ID: uuid.New()}, Chirp{ID: uuid.New()}, Chirp{ID: uuid.New()}
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		expectViewer  any
+		wantLikedByMe map[uuid.UUID]bool
+	}{
+		{
+			name:          "authenticated",
+			ctx:           context.WithValue(context.Background(), contextKeyUserID, viewerID),
+			expectViewer:  viewerID,
+			wantLikedByMe: map[uuid.UUID]bool{liked.ID: true, popular.ID: false, unliked.ID: false},
+		},
+		{
+			name:         "anonymous",
+			ctx:          context.Background(),
+			expectViewer: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			// a single query covers every chirp, chirps without likes are absent from its result
+			mock.ExpectQuery("FROM chirp_likes").
+				WithArgs(tt.expectViewer, sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"chirp_id", "like_count", "liked_by_me"}).
+					AddRow(liked.ID, 1, true).
+					AddRow(popular.ID, 42, false))
+
+			chirps := []Chirp{liked, popular, unliked}
+			if err := srv.withLikeStats(tt.ctx, chirpRefs(chirps)...); err != nil {
+				t.Fatalf("withLikeStats() error = %v", err)
+			}
+
+			wantCounts := map[uuid.UUID]int64{liked.ID: 1, popular.ID: 42, unliked.ID: 0}
+			for _, c := range chirps {
+				if c.LikeCount != wantCounts[c.ID] {
+					t.Errorf("expected chirp %v to have %d likes, got %d", c.ID, wantCounts[c.ID], c.LikeCount)
+				}
+				if tt.wantLikedByMe == nil {
+					if c.LikedByMe != nil {
+						t.Errorf("expected liked_by_me to be omitted for anonymous requests")
+					}
+					continue
+				}
+				if c.LikedByMe == nil || *c.LikedByMe != tt.wantLikedByMe[c.ID] {
+					t.Errorf("expected chirp %v liked_by_me %v, got %v", c.ID, tt.wantLikedByMe[c.ID], c.LikedByMe)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+
+	t.Run("no chirps", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock db: %v", err)
+		}
+		defer db.Close()
+
+		srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		if err := srv.withLikeStats(context.Background()); err != nil {
+			t.Fatalf("withLikeStats() error = %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet mock expectations: %v", err)
+		}
+	})
+}
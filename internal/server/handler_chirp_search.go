@@ -0,0 +1,116 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+func (srv *Server) SearchChirps(w http.ResponseWriter, r *http.Request) error {
+	query, ok := buildTSQuery(r.URL.Query().Get("q"))
+	if !ok {
+		return APIError{Status: http.StatusBadRequest, Msg: "Search query cannot be empty"}
+	}
+
+	authorID, err := parseAuthorID(r)
+	if err != nil {
+		return err
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		return err
+	}
+	cursorCreatedAt, cursorID := page.cursorArgs()
+	cursorRank := sql.NullFloat64{}
+	if page.Cursor != nil {
+		if page.Cursor.Rank == nil {
+			return APIError{Status: http.StatusBadRequest, Msg: "Invalid cursor"}
+		}
+		cursorRank = sql.NullFloat64{Float64: float64(*page.Cursor.Rank), Valid: true}
+	}
+
+	srv.logger.Info("Searching chirps", "query", query, "author_id", authorID.UUID, "limit", page.Limit)
+	rows, err := srv.db.SearchChirps(r.Context(), database.SearchChirpsParams{
+		Query:           query,
+		AuthorID:        authorID,
+		CursorRank:      cursorRank,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        page.rowLimit(),
+	})
+	if err != nil {
+		srv.logger.Error("Error searching chirps", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	rows, nextCursor := paginate(rows, page, func(row database.SearchChirpsRow) pageCursor {
+		rank := row.Rank
+		return pageCursor{CreatedAt: row.CreatedAt, ID: row.ID, Rank: &rank}
+	})
+	chirps := make([]Chirp, 0, len(rows))
+	for _, row := range rows {
+		chirps = append(chirps, mapDbChirp(database.Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			InReplyTo: row.InReplyTo,
+		}))
+	}
+	if err := srv.withLikeStats(r.Context(), chirpRefs(chirps)...); err != nil {
+		srv.logger.Error("Error getting chirp likes", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	return respondWithJSON(w, http.StatusOK, ChirpPage{
+		Chirps:     chirps,
+		NextCursor: nextCursor,
+	})
+}
+
+// buildTSQuery translates a user-supplied search string into Postgres to_tsquery syntax.
+// All terms must match; "quoted phrases" must match as adjacent words and a trailing `*`
+// turns a word into a prefix match. Any other punctuation is ignored, so the result is
+// always a syntactically valid query. Returns false if the input contains no searchable words.
+func buildTSQuery(input string) (string, bool) {
+	var terms []string
+	for i, part := range strings.Split(input, `"`) {
+		// Every odd part was enclosed in quotes.
+		if i%2 == 1 {
+			if words := tsWords(part, false); len(words) > 0 {
+				terms = append(terms, "("+strings.Join(words, " <-> ")+")")
+			}
+			continue
+		}
+		terms = append(terms, tsWords(part, true)...)
+	}
+	if len(terms) == 0 {
+		return "", false
+	}
+	return strings.Join(terms, " & "), true
+}
+
+// tsWords splits text into lexemes made of letters and digits only.
+// When allowPrefix is set, a word directly followed by `*` becomes a prefix match.
+func tsWords(text string, allowPrefix bool) []string {
+	var words []string
+	for _, field := range strings.Fields(text) {
+		prefix := allowPrefix && strings.HasSuffix(field, "*")
+		parts := strings.FieldsFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for i, p := range parts {
+			p = strings.ToLower(p)
+			if prefix && i == len(parts)-1 {
+				p += ":*"
+			}
+			words = append(words, p)
+		}
+	}
+	return words
+}
@@ -0,0 +1,35 @@
+package server
+
+import "testing"
+
+func TestBuildTSQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   string
+		wantOK bool
+	}{
+		{name: "single word", input: "Hello", want: "hello", wantOK: true},
+		{name: "all words must match", input: "hello world", want: "hello & world", wantOK: true},
+		{name: "phrase", input: `"hello big world"`, want: "(hello <-> big <-> world)", wantOK: true},
+		{name: "prefix", input: "chir*", want: "chir:*", wantOK: true},
+		{name: "mixed", input: `go "web server" http*`, want: "go & (web <-> server) & http:*", wantOK: true},
+		{name: "asterisk inside phrase is ignored", input: `"chir* away"`, want: "(chir <-> away)", wantOK: true},
+		{name: "tsquery operators are stripped", input: "a & !b | (c:*)", want: "a & b & c", wantOK: true},
+		{name: "unterminated quote", input: `"hello world`, want: "(hello <-> world)", wantOK: true},
+		{name: "empty", input: "   ", wantOK: false},
+		{name: "punctuation only", input: `!& "" *`, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := buildTSQuery(tt.input)
+			if ok != tt.wantOK {
+				t.Fatalf("buildTSQuery(%q) ok = %v, want %v", tt.input, ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("buildTSQuery(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+const (
+	maxThreadDepth int32 = 100
+	maxThreadSize  int32 = 1000
+)
+
+// ThreadNode is a single chirp within a conversation.
+// Deleted chirps are rendered as tombstones: they keep their place in the thread but carry no content.
+type ThreadNode struct {
+	ID         uuid.UUID    `json:"id"`
+	Deleted    bool         `json:"deleted"`
+	Chirp      *Chirp       `json:"chirp,omitempty"`
+	ReplyCount int          `json:"reply_count"`
+	Replies    []ThreadNode `json:"replies,omitempty"`
+}
+
+// Thread is the conversation surrounding a chirp: the chain of chirps it replies to, oldest first,
+// and the tree of replies it received. Ancestors only carry their reply counts, not their replies.
+// Truncated is set when the reply tree has more chirps than a single thread returns.
+type Thread struct {
+	Ancestors []ThreadNode `json:"ancestors"`
+	Chirp     ThreadNode   `json:"chirp"`
+	Truncated bool         `json:"truncated"`
+}
+
+func (srv *Server) GetChirpThread(w http.ResponseWriter, r *http.Request) error {
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, err := uuid.Parse(chirpID)
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	dbChirp, err := srv.db.GetChirp(r.Context(), chirpUUID)
+	if err != nil {
+		srv.logger.Info("Chirp not found", "err", err)
+		return APIError{Status: http.StatusNotFound, Msg: "Chirp with given id has not been found"}
+	}
+
+	ancestors, err := srv.db.GetChirpAncestors(r.Context(), database.GetChirpAncestorsParams{
+		ChirpID:  chirpUUID,
+		MaxDepth: maxThreadDepth,
+	})
+	if err != nil {
+		srv.logger.Error("Error getting chirp ancestors", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	// one more reply than returned is fetched to tell whether the tree is cut off
+	descendants, err := srv.db.GetChirpDescendants(r.Context(), database.GetChirpDescendantsParams{
+		ChirpID:  chirpUUID,
+		MaxDepth: maxThreadDepth,
+		RowLimit: maxThreadSize + 1,
+	})
+	if err != nil {
+		srv.logger.Error("Error getting chirp replies", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	truncated := len(descendants) > int(maxThreadSize)
+	if truncated {
+		descendants = descendants[:maxThreadSize]
+	}
+
+	thread := buildThread(dbChirp, ancestors, descendants)
+	thread.Truncated = truncated
+	if err := srv.withAncestorReplyCounts(r.Context(), &thread); err != nil {
+		srv.logger.Error("Error counting chirp replies", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if err := srv.withLikeStats(r.Context(), thread.chirps()...); err != nil {
+		srv.logger.Error("Error getting chirp likes", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	srv.logger.Info("Getting thread of chirp", "id", chirpUUID, "ancestors", len(ancestors), "descendants", len(descendants), "truncated", truncated)
+	return respondWithJSON(w, http.StatusOK, thread)
+}
+
+// buildThread assembles the reply tree below root from a flat list of its descendants.
+// Deleted chirps are kept as tombstones only when some of their replies are still visible.
+func buildThread(root database.Chirp, ancestors, descendants []database.Chirp) Thread {
+	children := make(map[uuid.UUID][]database.Chirp)
+	for _, c := range descendants {
+		children[c.InReplyTo.UUID] = append(children[c.InReplyTo.UUID], c)
+	}
+
+	var build func(c database.Chirp) (ThreadNode, bool)
+	build = func(c database.Chirp) (ThreadNode, bool) {
+		node := newThreadNode(c)
+		for _, child := range children[c.ID] {
+			if reply, ok := build(child); ok {
+				node.Replies = append(node.Replies, reply)
+			}
+		}
+		node.ReplyCount = len(node.Replies)
+		return node, !node.Deleted || node.ReplyCount > 0
+	}
+
+	thread := Thread{Ancestors: make([]ThreadNode, 0, len(ancestors))}
+	for _, a := range ancestors {
+		thread.Ancestors = append(thread.Ancestors, newThreadNode(a))
+	}
+	thread.Chirp, _ = build(root)
+	return thread
+}
+
+// withAncestorReplyCounts counts the replies of the ancestors, whose replies are not part of the thread.
+// Like in the reply tree, deleted replies only count while they are replied to.
+func (srv *Server) withAncestorReplyCounts(ctx context.Context, thread *Thread) error {
+	if len(thread.Ancestors) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(thread.Ancestors))
+	for _, a := range thread.Ancestors {
+		ids = append(ids, a.ID)
+	}
+	counts, err := srv.db.CountChirpReplies(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	byChirp := make(map[uuid.UUID]int, len(counts))
+	for _, c := range counts {
+		byChirp[c.ChirpID] = int(c.ReplyCount)
+	}
+	for i := range thread.Ancestors {
+		thread.Ancestors[i].ReplyCount = byChirp[thread.Ancestors[i].ID]
+	}
+	return nil
+}
+
+// chirps returns every visible chirp in the thread.
+func (t *Thread) chirps() []*Chirp {
+	var chirps []*Chirp
+	var collect func(node *ThreadNode)
+	collect = func(node *ThreadNode) {
+		if node.Chirp != nil {
+			chirps = append(chirps, node.Chirp)
+		}
+		for i := range node.Replies {
+			collect(&node.Replies[i])
+		}
+	}
+	for i := range t.Ancestors {
+		collect(&t.Ancestors[i])
+	}
+	collect(&t.Chirp)
+	return chirps
+}
+
+func newThreadNode(c database.Chirp) ThreadNode {
+	if c.DeletedAt.Valid {
+		return ThreadNode{ID: c.ID, Deleted: true}
+	}
+	chirp := mapDbChirp(c)
+	return ThreadNode{ID: c.ID, Chirp: &chirp}
+}
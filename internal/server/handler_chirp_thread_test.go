@@ -0,0 +1,144 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+func TestBuildThread(t *testing.T) {
+	now := time.Now()
+	newChirp := func(parent *database.Chirp, deleted bool) database.Chirp {
+		c := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "chirp", UserID: uuid.New()}
+		if parent != nil {
+			c.InReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+		if deleted {
+			c.Body = ""
+			c.DeletedAt = sql.NullTime{Time: now, Valid: true}
+		}
+		return c
+	}
+
+	grandparent := newChirp(nil, true)
+	parent := newChirp(&grandparent, false)
+	root := newChirp(&parent, false)
+	reply := newChirp(&root, false)
+	deletedReply := newChirp(&root, true)
+	replyToDeleted := newChirp(&deletedReply, false)
+	deletedLeaf := newChirp(&root, true)
+	nestedReply := newChirp(&reply, false)
+
+	thread := buildThread(
+		root,
+		[]database.Chirp{grandparent, parent},
+		[]database.Chirp{reply, deletedReply, replyToDeleted, deletedLeaf, nestedReply},
+	)
+
+	if len(thread.Ancestors) != 2 {
+		t.Fatalf("expected 2 ancestors, got %d", len(thread.Ancestors))
+	}
+	if !thread.Ancestors[0].Deleted || thread.Ancestors[0].Chirp != nil {
+		t.Errorf("expected deleted ancestor to be rendered as a tombstone, got %+v", thread.Ancestors[0])
+	}
+	if thread.Ancestors[1].Chirp == nil || thread.Ancestors[1].Chirp.ID != parent.ID {
+		t.Errorf("expected direct parent as the last ancestor, got %+v", thread.Ancestors[1])
+	}
+
+	if thread.Chirp.ID != root.ID {
+		t.Fatalf("expected thread to be centered on %v, got %v", root.ID, thread.Chirp.ID)
+	}
+	if thread.Chirp.ReplyCount != 2 {
+		t.Fatalf("expected deleted leaf to be pruned leaving 2 replies, got %d", thread.Chirp.ReplyCount)
+	}
+
+	first, second := thread.Chirp.Replies[0], thread.Chirp.Replies[1]
+	if first.ID != reply.ID || first.ReplyCount != 1 || first.Replies[0].ID != nestedReply.ID {
+		t.Errorf("expected reply with one nested reply, got %+v", first)
+	}
+	if second.ID != deletedReply.ID || !second.Deleted || second.Chirp != nil {
+		t.Errorf("expected tombstone for deleted reply, got %+v", second)
+	}
+	if second.ReplyCount != 1 || second.Replies[0].ID != replyToDeleted.ID {
+		t.Errorf("expected tombstone to keep its reply, got %+v", second)
+	}
+}
+
+func TestGetChirpThread(t *testing.T) {
+	tests := []struct {
+		name          string
+		replies       int
+		wantReplies   int
+		wantTruncated bool
+	}{
+		{name: "complete thread", replies: 2, wantReplies: 2},
+		{name: "truncated thread", replies: int(maxThreadSize) + 1, wantReplies: int(maxThreadSize), wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+			userID, parentID, chirpID := uuid.New(), uuid.New(), uuid.New()
+			mock.ExpectQuery("FROM chirps").WithArgs(chirpID).
+				WillReturnRows(sqlmock.NewRows(chirpColumns).AddRow(chirpID, now, now, "chirp", userID, parentID, nil))
+			mock.ExpectQuery("WITH RECURSIVE ancestors").WithArgs(chirpID, maxThreadDepth).
+				WillReturnRows(sqlmock.NewRows(chirpColumns).AddRow(parentID, now, now, "parent", userID, nil, nil))
+			replies := sqlmock.NewRows(chirpColumns)
+			for range tt.replies {
+				replies.AddRow(uuid.New(), now, now, "reply", userID, chirpID, nil)
+			}
+			mock.ExpectQuery("WITH RECURSIVE descendants").WithArgs(chirpID, maxThreadDepth, maxThreadSize+1).
+				WillReturnRows(replies)
+			mock.ExpectQuery("FROM chirps replies").WithArgs(sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"chirp_id", "reply_count"}).AddRow(parentID, 3))
+			mock.ExpectQuery("FROM chirp_likes").
+				WillReturnRows(sqlmock.NewRows([]string{"chirp_id", "like_count", "liked_by_me"}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirpID.String()+"/thread", nil)
+			req.SetPathValue("chirpID", chirpID.String())
+			w := httptest.NewRecorder()
+			if err := srv.GetChirpThread(w, req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var thread Thread
+			if err := json.NewDecoder(w.Body).Decode(&thread); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(thread.Ancestors) != 1 || thread.Ancestors[0].ReplyCount != 3 {
+				t.Errorf("expected the parent to report 3 replies, got %+v", thread.Ancestors)
+			}
+			if thread.Chirp.ReplyCount != tt.wantReplies {
+				t.Errorf("expected %d replies, got %d", tt.wantReplies, thread.Chirp.ReplyCount)
+			}
+			if thread.Truncated != tt.wantTruncated {
+				t.Errorf("expected truncated to be %v, got %v", tt.wantTruncated, thread.Truncated)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
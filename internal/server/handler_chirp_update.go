@@ -0,0 +1,123 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+type ChirpRevision struct {
+	ID        uuid.UUID `json:"id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (srv *Server) UpdateChirp(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		Body string `json:"body"`
+	}
+
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, err := uuid.Parse(chirpID)
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	dbChirp, err := srv.db.GetChirp(r.Context(), chirpUUID)
+	if err != nil {
+		srv.logger.Info("Chirp not found", "err", err)
+		return APIError{Status: http.StatusNotFound, Msg: "Chirp with given id has not been found"}
+	}
+	if dbChirp.UserID != parsedUserID {
+		return APIError{Status: http.StatusForbidden, Msg: "Editing chirps of other users is not allowed"}
+	}
+	if window := srv.cfg.ChirpEditWindow; window > 0 && time.Since(dbChirp.CreatedAt) > window {
+		return APIError{Status: http.StatusForbidden, Msg: fmt.Sprintf("Chirps can only be edited within %s of posting", window)}
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	payload := input{}
+	if err := decoder.Decode(&payload); err != nil {
+		srv.logger.Error("Error decoding JSON body", "err", err)
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+	}
+
+	cleanedBody, err := srv.validateChirpBody(r.Context(), parsedUserID, payload.Body)
+	if err != nil {
+		return err
+	}
+
+	if cleanedBody != dbChirp.Body {
+		err = srv.withTx(r.Context(), func(q *database.Queries) error {
+			var err error
+			dbChirp, err = q.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+				ID:   chirpUUID,
+				Body: cleanedBody,
+			})
+			if err != nil {
+				return err
+			}
+			return events.Record(r.Context(), q, events.ChirpUpdated, parsedUserID, mapDbChirp(dbChirp))
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return APIError{Status: http.StatusNotFound, Msg: "Chirp with given id has not been found"}
+			}
+			srv.logger.Error("Error updating chirp", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+	}
+
+	chirp := mapDbChirp(dbChirp)
+	if err := srv.withLikeStats(r.Context(), &chirp); err != nil {
+		srv.logger.Error("Error getting chirp likes", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	srv.logger.Info("Updated chirp", "id", chirpUUID)
+	return respondWithJSON(w, http.StatusOK, chirp)
+}
+
+func (srv *Server) GetChirpRevisions(w http.ResponseWriter, r *http.Request) error {
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, err := uuid.Parse(chirpID)
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	if _, err := srv.db.GetChirp(r.Context(), chirpUUID); err != nil {
+		srv.logger.Info("Chirp not found", "err", err)
+		return APIError{Status: http.StatusNotFound, Msg: "Chirp with given id has not been found"}
+	}
+
+	dbRevisions, err := srv.db.ListChirpRevisions(r.Context(), chirpUUID)
+	if err != nil {
+		srv.logger.Error("Error listing chirp revisions", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	revisions := make([]ChirpRevision, 0, len(dbRevisions))
+	for _, rev := range dbRevisions {
+		revisions = append(revisions, ChirpRevision{
+			ID:        rev.ID,
+			ChirpID:   rev.ChirpID,
+			Body:      rev.Body,
+			CreatedAt: rev.CreatedAt,
+		})
+	}
+	return respondWithJSON(w, http.StatusOK, revisions)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+func TestUpdateChirp(t *testing.T) {
+	ownerID := uuid.New()
+	chirpColumns := []string{"id", "created_at", "updated_at", "body", "user_id", "in_reply_to", "deleted_at"}
+
+	tests := []struct {
+		name           string
+		userID         uuid.UUID
+		editWindow     time.Duration
+		createdAgo     time.Duration
+		requestBody    string
+		expectedStatus int
+		expectedError  string
+		wantBody       string
+	}{
+		{
+			name:           "happy path",
+			userID:         ownerID,
+			requestBody:    `{"body": "Edited kerfuffle"}`,
+			expectedStatus: http.StatusOK,
+			wantBody:       "Edited ****",
+		},
+		{
+			name:           "other user",
+			userID:         uuid.New(),
+			requestBody:    `{"body": "Edited"}`,
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "Editing chirps of other users is not allowed",
+		},
+		{
+			name:           "edit window elapsed",
+			userID:         ownerID,
+			editWindow:     15 * time.Minute,
+			createdAgo:     time.Hour,
+			requestBody:    `{"body": "Edited"}`,
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "Chirps can only be edited within 15m0s of posting",
+		},
+		{
+			name:           "chirp too long",
+			userID:         ownerID,
+			requestBody:    `{"body": "` + strings.Repeat("a", maxLongChirpLength+1) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Chirp is too long",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			cfg := &config.Config{ChirpEditWindow: tt.editWindow}
+			srv, err := NewServer(cfg, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			chirpID := uuid.New()
+			createdAt := time.Now().Add(-tt.createdAgo)
+			mock.ExpectQuery("SELECT (.+) FROM chirps").
+				WithArgs(chirpID).
+				WillReturnRows(sqlmock.NewRows(chirpColumns).
+					AddRow(chirpID, createdAt, createdAt, "Original", ownerID, nil, nil))
+			if tt.expectedError == "" {
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE chirps").
+					WithArgs(chirpID, tt.wantBody).
+					WillReturnRows(sqlmock.NewRows(chirpColumns).
+						AddRow(chirpID, createdAt, time.Now(), tt.wantBody, ownerID, nil, nil))
+				mock.ExpectExec("INSERT INTO outbox").
+					WithArgs(sqlmock.AnyArg(), events.ChirpUpdated, ownerID, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery("FROM chirp_likes").
+					WillReturnRows(sqlmock.NewRows([]string{"chirp_id", "like_count", "liked_by_me"}))
+			}
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/chirps/"+chirpID.String(), strings.NewReader(tt.requestBody))
+			req.SetPathValue("chirpID", chirpID.String())
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, tt.userID))
+
+			w := httptest.NewRecorder()
+			err = srv.UpdateChirp(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+				var response Chirp
+				if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if response.Body != tt.wantBody {
+					t.Errorf("expected body %q, got %q", tt.wantBody, response.Body)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+// FollowEntry describes a user on one side of a follow relationship.
+type FollowEntry struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Username    string    `json:"username,omitempty"`
+	DisplayName string    `json:"display_name,omitempty"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	FollowedAt  time.Time `json:"followed_at"`
+}
+
+// FollowPage is a single page of followers or followees along with the cursor pointing at the next one.
+type FollowPage struct {
+	Users      []FollowEntry `json:"users"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+func (srv *Server) FollowUser(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+	if followeeID == parsedUserID {
+		return APIError{Status: http.StatusBadRequest, Msg: "Users cannot follow themselves"}
+	}
+
+	if _, err := srv.db.GetUserByID(r.Context(), followeeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIError{Status: http.StatusNotFound, Msg: "User with given id has not been found"}
+		}
+		srv.logger.Error("Error getting user", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	err = srv.withTx(r.Context(), func(q *database.Queries) error {
+		followed, err := q.FollowUser(r.Context(), database.FollowUserParams{
+			FollowerID: parsedUserID,
+			FolloweeID: followeeID,
+		})
+		if err != nil || followed == 0 {
+			return err
+		}
+		return events.Record(r.Context(), q, events.UserFollowed, followeeID, map[string]uuid.UUID{
+			"follower_id": parsedUserID,
+			"followee_id": followeeID,
+		})
+	})
+	if err != nil {
+		srv.logger.Error("Error following user", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	respondWithNoContent(w)
+	return nil
+}
+
+func (srv *Server) UnfollowUser(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	err = srv.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: parsedUserID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		srv.logger.Error("Error unfollowing user", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	respondWithNoContent(w)
+	return nil
+}
+
+func (srv *Server) GetFollowers(w http.ResponseWriter, r *http.Request) error {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		return err
+	}
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	rows, err := srv.db.ListFollowers(r.Context(), database.ListFollowersParams{
+		UserID:          userID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        page.rowLimit(),
+	})
+	if err != nil {
+		srv.logger.Error("Error listing followers", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	rows, nextCursor := paginate(rows, page, func(row database.ListFollowersRow) pageCursor {
+		return pageCursor{CreatedAt: row.FollowedAt, ID: row.ID}
+	})
+	entries := make([]FollowEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, FollowEntry{
+			ID:          row.ID,
+			CreatedAt:   row.CreatedAt,
+			Username:    row.Username.String,
+			DisplayName: row.DisplayName.String,
+			AvatarURL:   row.AvatarUrl.String,
+			IsChirpyRed: row.IsChirpyRed,
+			FollowedAt:  row.FollowedAt,
+		})
+	}
+
+	return respondWithJSON(w, http.StatusOK, FollowPage{Users: entries, NextCursor: nextCursor})
+}
+
+func (srv *Server) GetFollowing(w http.ResponseWriter, r *http.Request) error {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		return err
+	}
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	rows, err := srv.db.ListFollowing(r.Context(), database.ListFollowingParams{
+		UserID:          userID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        page.rowLimit(),
+	})
+	if err != nil {
+		srv.logger.Error("Error listing followed users", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	rows, nextCursor := paginate(rows, page, func(row database.ListFollowingRow) pageCursor {
+		return pageCursor{CreatedAt: row.FollowedAt, ID: row.ID}
+	})
+	entries := make([]FollowEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, FollowEntry{
+			ID:          row.ID,
+			CreatedAt:   row.CreatedAt,
+			Username:    row.Username.String,
+			DisplayName: row.DisplayName.String,
+			AvatarURL:   row.AvatarUrl.String,
+			IsChirpyRed: row.IsChirpyRed,
+			FollowedAt:  row.FollowedAt,
+		})
+	}
+
+	return respondWithJSON(w, http.StatusOK, FollowPage{Users: entries, NextCursor: nextCursor})
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+// followColumns lists the columns returned by the follower and followee queries.
+var followColumns = []string{"id", "created_at", "username", "display_name", "avatar_url", "is_chirpy_red", "followed_at"}
+
+func TestFollowUser(t *testing.T) {
+	userID := uuid.New()
+	followeeID := uuid.New()
+
+	tests := []struct {
+		name           string
+		followeeID     string
+		setupMock      func(mock sqlmock.Sqlmock)
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:       "follow",
+			followeeID: followeeID.String(),
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM users").
+					WithArgs(followeeID).
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(mockUserRow(followeeID, "bob@example.com", "hash")...))
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO follows").
+					WithArgs(userID, followeeID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO outbox").
+					WithArgs(sqlmock.AnyArg(), events.UserFollowed, followeeID, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:       "duplicate follow records no event",
+			followeeID: followeeID.String(),
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM users").
+					WithArgs(followeeID).
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(mockUserRow(followeeID, "bob@example.com", "hash")...))
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO follows").
+					WithArgs(userID, followeeID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "self follow",
+			followeeID:     userID.String(),
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Users cannot follow themselves",
+		},
+		{
+			name:           "invalid user id",
+			followeeID:     "not-a-uuid",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Error parsing UUID: invalid UUID length: 10",
+		},
+		{
+			name:       "unknown user",
+			followeeID: followeeID.String(),
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM users").
+					WithArgs(followeeID).
+					WillReturnRows(sqlmock.NewRows(userColumns))
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "User with given id has not been found",
+		},
+		{
+			name:       "database error rolls back",
+			followeeID: followeeID.String(),
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM users").
+					WithArgs(followeeID).
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(mockUserRow(followeeID, "bob@example.com", "hash")...))
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO follows").
+					WithArgs(userID, followeeID).
+					WillReturnError(errors.New("connection reset"))
+				mock.ExpectRollback()
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "Internal Server Error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+			if tt.setupMock != nil {
+				tt.setupMock(mock)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/users/"+tt.followeeID+"/follow", nil)
+			req.SetPathValue("userID", tt.followeeID)
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+			w := httptest.NewRecorder()
+			err = srv.FollowUser(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnfollowUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	userID := uuid.New()
+	followeeID := uuid.New()
+	// unfollowing a user that is not followed succeeds as well, so the request can be retried
+	for range 2 {
+		mock.ExpectExec("DELETE FROM follows").
+			WithArgs(userID, followeeID).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		req := httptest.NewRequest(http.MethodDelete, "/api/users/"+followeeID.String()+"/follow", nil)
+		req.SetPathValue("userID", followeeID.String())
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+		w := httptest.NewRecorder()
+		if err := srv.UnfollowUser(w, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if w.Code != http.StatusNoContent {
+			t.Errorf("expected status %d, got %d", http.StatusNoContent, w.Code)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestFollowLists(t *testing.T) {
+	userID := uuid.New()
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+
+	handlers := []struct {
+		name        string
+		expectQuery string
+		handler     func(srv *Server) func(http.ResponseWriter, *http.Request) error
+	}{
+		{
+			name:        "followers",
+			expectQuery: "JOIN users ON users.id = follows.follower_id",
+			handler:     func(srv *Server) func(http.ResponseWriter, *http.Request) error { return srv.GetFollowers },
+		},
+		{
+			name:        "following",
+			expectQuery: "JOIN users ON users.id = follows.followee_id",
+			handler:     func(srv *Server) func(http.ResponseWriter, *http.Request) error { return srv.GetFollowing },
+		},
+	}
+	cursor := pageCursor{CreatedAt: base, ID: ids[0]}
+	tests := []struct {
+		name           string
+		query          string
+		expectArgs     []driver.Value
+		rows           int
+		wantUsers      int
+		wantNextCursor bool
+	}{
+		{
+			name:           "first page with more results",
+			query:          "?limit=2",
+			expectArgs:     []driver.Value{userID, nil, nil, int32(3)},
+			rows:           3,
+			wantUsers:      2,
+			wantNextCursor: true,
+		},
+		{
+			name:       "continue from cursor",
+			query:      "?limit=2&cursor=" + encodeCursor(cursor),
+			expectArgs: []driver.Value{userID, sqlmock.AnyArg(), cursor.ID, int32(3)},
+			rows:       1,
+			wantUsers:  1,
+		},
+	}
+
+	for _, h := range handlers {
+		for _, tt := range tests {
+			t.Run(h.name+"/"+tt.name, func(t *testing.T) {
+				db, mock, err := sqlmock.New()
+				if err != nil {
+					t.Fatalf("failed to create mock db: %v", err)
+				}
+				defer db.Close()
+
+				srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+				if err != nil {
+					t.Fatalf("failed to create server: %v", err)
+				}
+
+				rows := sqlmock.NewRows(followColumns)
+				for i := 0; i < tt.rows; i++ {
+					followedAt := base.Add(-time.Duration(i) * time.Minute)
+					rows.AddRow(ids[i], base, "user", nil, nil, false, followedAt)
+				}
+				mock.ExpectQuery(h.expectQuery).WithArgs(tt.expectArgs...).WillReturnRows(rows)
+
+				req := httptest.NewRequest(http.MethodGet, "/api/users/"+userID.String()+"/"+h.name+tt.query, nil)
+				req.SetPathValue("userID", userID.String())
+				w := httptest.NewRecorder()
+				if err := h.handler(srv)(w, req); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != http.StatusOK {
+					t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+				}
+
+				var response FollowPage
+				if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if len(response.Users) != tt.wantUsers {
+					t.Errorf("expected %d users, got %d", tt.wantUsers, len(response.Users))
+				}
+				if (response.NextCursor != "") != tt.wantNextCursor {
+					t.Errorf("expected next cursor presence %v, got %q", tt.wantNextCursor, response.NextCursor)
+				}
+				if tt.wantNextCursor {
+					next, err := decodeCursor(response.NextCursor)
+					if err != nil {
+						t.Fatalf("failed to decode next cursor: %v", err)
+					}
+					last := response.Users[len(response.Users)-1]
+					if next.ID != last.ID || !next.CreatedAt.Equal(last.FollowedAt) {
+						t.Errorf("expected cursor to point at the last follow of %v, got %v", last.ID, next.ID)
+					}
+				}
+
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Errorf("unmet mock expectations: %v", err)
+				}
+			})
+		}
+	}
+}
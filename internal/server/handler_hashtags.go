@@ -0,0 +1,97 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+const (
+	defaultTrendingWindow time.Duration = 24 * time.Hour
+	maxTrendingWindow     time.Duration = 7 * 24 * time.Hour
+	defaultTrendingLimit  int           = 10
+	maxTrendingLimit      int           = 50
+)
+
+type TrendingHashtag struct {
+	Tag        string `json:"tag"`
+	ChirpCount int64  `json:"chirp_count"`
+}
+
+func (srv *Server) GetHashtagChirps(w http.ResponseWriter, r *http.Request) error {
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	if tag == "" {
+		return APIError{Status: http.StatusBadRequest, Msg: "Hashtag cannot be empty"}
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		return err
+	}
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	srv.logger.Info("Getting chirps for hashtag", "tag", tag, "limit", page.Limit)
+	dbChirps, err := srv.db.ListChirpsByHashtag(r.Context(), database.ListChirpsByHashtagParams{
+		Tag:             tag,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        page.rowLimit(),
+	})
+	if err != nil {
+		srv.logger.Error("Error getting chirps for hashtag", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	dbChirps, nextCursor := paginate(dbChirps, page, chirpCursor)
+	chirps := mapDbChirps(dbChirps)
+	if err := srv.withLikeStats(r.Context(), chirpRefs(chirps)...); err != nil {
+		srv.logger.Error("Error getting chirp likes", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	return respondWithJSON(w, http.StatusOK, ChirpPage{
+		Chirps:     chirps,
+		NextCursor: nextCursor,
+	})
+}
+
+// GetTrendingHashtags returns the hashtags used by the most chirps posted within the `window`
+// query parameter (a duration such as `6h`, defaulting to 24 hours).
+func (srv *Server) GetTrendingHashtags(w http.ResponseWriter, r *http.Request) error {
+	window := defaultTrendingWindow
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		parsed, err := time.ParseDuration(windowStr)
+		if err != nil || parsed < time.Minute || parsed > maxTrendingWindow {
+			return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Window must be a duration between 1m and %s", maxTrendingWindow)}
+		}
+		window = parsed
+	}
+
+	limit := defaultTrendingLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > maxTrendingLimit {
+			return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Limit must be a number between 1 and %d", maxTrendingLimit)}
+		}
+		limit = parsed
+	}
+
+	rows, err := srv.db.GetTrendingHashtags(r.Context(), database.GetTrendingHashtagsParams{
+		WindowSeconds: int32(window.Seconds()),
+		RowLimit:      int32(limit),
+	})
+	if err != nil {
+		srv.logger.Error("Error getting trending hashtags", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	trending := make([]TrendingHashtag, 0, len(rows))
+	for _, row := range rows {
+		trending = append(trending, TrendingHashtag{Tag: row.Tag, ChirpCount: row.ChirpCount})
+	}
+	return respondWithJSON(w, http.StatusOK, trending)
+}
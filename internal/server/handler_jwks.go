@@ -0,0 +1,16 @@
+package server
+
+import (
+	"net/http"
+)
+
+// jwksMaxAge is how long clients may cache the key set. Keys must be published for at least
+// this long before they start signing tokens, so that verifiers pick them up in time.
+const jwksMaxAge = "max-age=300"
+
+// GetJWKS publishes the public keys JWTs are verified with, so other services can verify tokens
+// without holding a shared secret. The set is empty while tokens are signed with the HMAC secret.
+func (srv *Server) GetJWKS(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Cache-Control", "public, "+jwksMaxAge)
+	return respondWithJSON(w, http.StatusOK, srv.keys.JWKS())
+}
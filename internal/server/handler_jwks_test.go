@@ -0,0 +1,120 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func writeEd25519KeyFile(t *testing.T) string {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return path
+}
+
+func TestGetJWKS(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          *config.Config
+		expectedKeys int
+	}{
+		{
+			name:         "HMAC secret is never published",
+			cfg:          &config.Config{TokenSecret: "secret"},
+			expectedKeys: 0,
+		},
+		{
+			name:         "signing key",
+			cfg:          &config.Config{TokenSecret: "secret", JWTSigningKeyFile: writeEd25519KeyFile(t)},
+			expectedKeys: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewServer(tt.cfg, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+			w := httptest.NewRecorder()
+			if err := srv.GetJWKS(w, req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var jwks auth.JWKS
+			if err := json.NewDecoder(w.Body).Decode(&jwks); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(jwks.Keys) != tt.expectedKeys {
+				t.Fatalf("expected %d keys, got %d", tt.expectedKeys, len(jwks.Keys))
+			}
+			if tt.expectedKeys == 0 {
+				return
+			}
+
+			// tokens issued by the server carry the kid of the published key
+			userID := uuid.New()
+			token, err := auth.MakeJWT(userID, auth.AllScopes, srv.keys, time.Hour)
+			if err != nil {
+				t.Fatalf("failed to make token: %v", err)
+			}
+			published, err := auth.ParsePEMKey(mustReadFile(t, tt.cfg.JWTSigningKeyFile))
+			if err != nil {
+				t.Fatalf("failed to parse key: %v", err)
+			}
+			if jwks.Keys[0].Kid != published.ID {
+				t.Errorf("expected kid %q, got %q", published.ID, jwks.Keys[0].Kid)
+			}
+			verifier, err := auth.NewKeySet(published)
+			if err != nil {
+				t.Fatalf("failed to create key set: %v", err)
+			}
+			if claims, err := auth.ValidateJWT(token, verifier); err != nil || claims.UserID != userID {
+				t.Errorf("expected token to verify with the published key, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewServer_InvalidSigningKey(t *testing.T) {
+	_, err := NewServer(&config.Config{JWTSigningKeyFile: filepath.Join(t.TempDir(), "missing.pem")}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil {
+		t.Fatal("expected an error, got none")
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	return data
+}
@@ -1,25 +1,38 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/google/uuid"
 	"github.com/szmktk/chirpy/internal/auth"
 	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/lockout"
 )
 
-const accessTokenExpirationTime time.Duration = time.Hour
+const (
+	accessTokenExpirationTime time.Duration = time.Hour
+	maxDeviceLabelLength      int           = 100
+)
+
+// loginResponse is returned once a user is fully authenticated.
+type loginResponse struct {
+	User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
 
 func (srv *Server) Login(w http.ResponseWriter, r *http.Request) error {
 	type input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	type response struct {
-		User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
+		Email       string `json:"email"`
+		Password    string `json:"password"`
+		DeviceLabel string `json:"device_label"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -37,6 +50,13 @@ func (srv *Server) Login(w http.ResponseWriter, r *http.Request) error {
 		return APIError{Status: http.StatusBadRequest, Msg: "Password cannot be empty"}
 	}
 
+	accountKey, ipKey := "account:"+strings.ToLower(payload.Email), "ip:"+srv.clientIP(r)
+	ipReservation, err := srv.reserveLogin(w, r, accountKey, ipKey)
+	if err != nil {
+		return err
+	}
+
+	// the attempt already counts as failed, so failures only need to be reported
 	user, err := srv.db.GetUserByEmail(r.Context(), payload.Email)
 	if err != nil {
 		srv.logger.Info("User not found", "err", err)
@@ -48,36 +68,108 @@ func (srv *Server) Login(w http.ResponseWriter, r *http.Request) error {
 		return APIError{Status: http.StatusUnauthorized, Msg: "Incorrect email or password"}
 	}
 
-	token, err := auth.MakeJWT(user.ID, srv.cfg.TokenSecret, accessTokenExpirationTime)
+	// The account is forgiven, the IP only gets its attempt back: an IP guessing passwords of many accounts
+	// must not reset its count by logging into an account of its own.
+	if err := srv.accountLockout.Succeed(r.Context(), accountKey); err != nil {
+		srv.logger.Error("Error resetting failed logins", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if err := srv.ipLockout.Refund(r.Context(), ipReservation); err != nil {
+		srv.logger.Error("Error refunding login attempt", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	if user.TotpEnabledAt.Valid {
+		challenge, err := srv.createLoginChallenge(r.Context(), user)
+		if err != nil {
+			srv.logger.Error("Error creating login challenge", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		return respondWithJSON(w, http.StatusOK, challenge)
+	}
+
+	session, err := srv.startSession(r, user, payload.DeviceLabel)
 	if err != nil {
-		srv.logger.Error("Error issuing user token", "err", err)
+		srv.logger.Error("Error starting session", "err", err)
 		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
+	return respondWithJSON(w, http.StatusOK, session)
+}
+
+// reserveLogin counts the login against the account and the client IP before the password is checked, so that
+// concurrent guesses cannot all pass before any of them is counted. The login is rejected with 429 while either
+// has to wait after repeated failures. Unknown emails are tracked like existing accounts, so the lockout does not
+// reveal which accounts exist. It returns the reservation of the IP, to be refunded if the login succeeds.
+func (srv *Server) reserveLogin(w http.ResponseWriter, r *http.Request, accountKey, ipKey string) (lockout.Reservation, error) {
+	account, wait, err := srv.accountLockout.Reserve(r.Context(), accountKey)
+	if err != nil {
+		srv.logger.Error("Error reserving login attempt", "err", err)
+		return lockout.Reservation{}, APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if wait > 0 {
+		return lockout.Reservation{}, srv.rejectLogin(w, accountKey, ipKey, wait)
+	}
+
+	ip, wait, err := srv.ipLockout.Reserve(r.Context(), ipKey)
+	if err != nil {
+		srv.logger.Error("Error reserving login attempt", "err", err)
+		return lockout.Reservation{}, APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if wait > 0 {
+		// the attempt is not made, so it must not count against the account either
+		if err := srv.accountLockout.Refund(r.Context(), account); err != nil {
+			srv.logger.Error("Error refunding login attempt", "err", err)
+			return lockout.Reservation{}, APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		return lockout.Reservation{}, srv.rejectLogin(w, accountKey, ipKey, wait)
+	}
+	return ip, nil
+}
+
+func (srv *Server) rejectLogin(w http.ResponseWriter, accountKey, ipKey string, wait time.Duration) error {
+	srv.logger.Warn("Login rejected after repeated failures", "account", accountKey, "ip", ipKey, "retry_after", wait)
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(wait)))
+	return APIError{Status: http.StatusTooManyRequests, Msg: "Too many failed login attempts, try again later"}
+}
+
+// startSession issues a new access token and refresh token pair for the user, recording the device
+// the request comes from. When the client does not name the device, a label is derived from its user agent.
+func (srv *Server) startSession(r *http.Request, user database.User, label string) (loginResponse, error) {
+	token, err := auth.MakeJWT(user.ID, auth.AllScopes, srv.keys, accessTokenExpirationTime)
+	if err != nil {
+		return loginResponse{}, fmt.Errorf("issuing user token: %w", err)
+	}
 
 	refreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		srv.logger.Error("Error issuing refresh token", "err", err)
-		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		return loginResponse{}, fmt.Errorf("issuing refresh token: %w", err)
+	}
+
+	// Every login starts a new token family, followed through all rotations of its refresh token.
+	ua := userAgent(r)
+	label = strings.TrimSpace(label)
+	if label == "" {
+		label = deviceLabel(ua)
+	}
+	if utf8.RuneCountInString(label) > maxDeviceLabelLength {
+		label = string([]rune(label)[:maxDeviceLabelLength])
 	}
 
 	_, err = srv.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:  refreshToken,
-		UserID: user.ID,
+		TokenHash:   auth.HashToken(refreshToken),
+		UserID:      user.ID,
+		FamilyID:    uuid.New(),
+		UserAgent:   sql.NullString{String: ua, Valid: ua != ""},
+		IpAddress:   sql.NullString{String: srv.clientIP(r), Valid: true},
+		DeviceLabel: sql.NullString{String: label, Valid: true},
 	})
 	if err != nil {
-		srv.logger.Error("Error saving refresh token", "err", err)
-		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		return loginResponse{}, fmt.Errorf("saving refresh token: %w", err)
 	}
 
-	return respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+	return loginResponse{
+		User:         mapDbUser(user),
 		Token:        token,
 		RefreshToken: refreshToken,
-	})
+	}, nil
 }
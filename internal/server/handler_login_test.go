@@ -0,0 +1,168 @@
+package server
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestLogin_Lockout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	cfg := &config.Config{
+		TokenSecret:           "secret",
+		LoginMaxFailures:      2,
+		LoginMaxFailuresPerIP: 10,
+		LoginLockoutBaseDelay: 30 * time.Second,
+		LoginLockoutMaxDelay:  15 * time.Minute,
+		LoginLockoutWindow:    time.Hour,
+	}
+	srv, err := NewServer(cfg, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	hashedPassword, err := auth.HashPassword("correct")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	userID := uuid.New()
+
+	login := func(email, password string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email": "`+email+`", "password": "`+password+`"}`))
+		w := httptest.NewRecorder()
+		return w, srv.Login(w, req)
+	}
+	expectStatus := func(err error, status int) {
+		t.Helper()
+		apiErr, ok := err.(APIError)
+		if !ok {
+			t.Fatalf("expected APIError, got %v", err)
+		}
+		if apiErr.Status != status {
+			t.Fatalf("expected status %d, got %d (%s)", status, apiErr.Status, apiErr.Msg)
+		}
+	}
+
+	// a successful login after a failure resets the count of the account
+	mock.ExpectQuery("FROM users").WithArgs("jane@example.com").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(mockUserRow(userID, "jane@example.com", hashedPassword)...))
+	_, err = login("jane@example.com", "wrong")
+	expectStatus(err, http.StatusUnauthorized)
+
+	mock.ExpectQuery("FROM users").WithArgs("jane@example.com").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(mockUserRow(userID, "jane@example.com", hashedPassword)...))
+	mock.ExpectQuery("INSERT INTO refresh_tokens").
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).AddRow(mockRefreshTokenRow(userID, uuid.New(), "hash", "")...))
+	if _, err := login("jane@example.com", "correct"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// unknown accounts are locked out like existing ones
+	for range 2 {
+		mock.ExpectQuery("FROM users").WithArgs("JOHN@example.com").WillReturnError(sql.ErrNoRows)
+		_, err = login("JOHN@example.com", "guess")
+		expectStatus(err, http.StatusUnauthorized)
+	}
+
+	// the lockout rejects the attempt without checking the password, regardless of the email case
+	w, err := login("john@example.com", "guess")
+	expectStatus(err, http.StatusTooManyRequests)
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After of 30 seconds, got %q", got)
+	}
+
+	// other accounts are not affected
+	mock.ExpectQuery("FROM users").WithArgs("jane@example.com").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(mockUserRow(userID, "jane@example.com", hashedPassword)...))
+	_, err = login("jane@example.com", "wrong")
+	expectStatus(err, http.StatusUnauthorized)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestLogin_IPLockout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	cfg := &config.Config{
+		TokenSecret:           "secret",
+		LoginMaxFailures:      10,
+		LoginMaxFailuresPerIP: 2,
+		LoginLockoutBaseDelay: 30 * time.Second,
+		LoginLockoutMaxDelay:  15 * time.Minute,
+		LoginLockoutWindow:    time.Hour,
+	}
+	srv, err := NewServer(cfg, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	hashedPassword, err := auth.HashPassword("correct")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	userID := uuid.New()
+
+	login := func(email, password string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email": "`+email+`", "password": "`+password+`"}`))
+		w := httptest.NewRecorder()
+		return w, srv.Login(w, req)
+	}
+	expectStatus := func(err error, status int) {
+		t.Helper()
+		apiErr, ok := err.(APIError)
+		if !ok {
+			t.Fatalf("expected APIError, got %v", err)
+		}
+		if apiErr.Status != status {
+			t.Fatalf("expected status %d, got %d (%s)", status, apiErr.Status, apiErr.Msg)
+		}
+	}
+
+	mock.ExpectQuery("FROM users").WithArgs("a@example.com").WillReturnError(sql.ErrNoRows)
+	_, err = login("a@example.com", "guess")
+	expectStatus(err, http.StatusUnauthorized)
+
+	// a successful login gives the IP its attempt back without forgiving the earlier failure
+	mock.ExpectQuery("FROM users").WithArgs("jane@example.com").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(mockUserRow(userID, "jane@example.com", hashedPassword)...))
+	mock.ExpectQuery("INSERT INTO refresh_tokens").
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).AddRow(mockRefreshTokenRow(userID, uuid.New(), "hash", "")...))
+	if _, err := login("jane@example.com", "correct"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mock.ExpectQuery("FROM users").WithArgs("b@example.com").WillReturnError(sql.ErrNoRows)
+	_, err = login("b@example.com", "guess")
+	expectStatus(err, http.StatusUnauthorized)
+
+	w, err := login("c@example.com", "guess")
+	expectStatus(err, http.StatusTooManyRequests)
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After of 30 seconds, got %q", got)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
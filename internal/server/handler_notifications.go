@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	Type      string     `json:"type"`
+	ActorID   uuid.UUID  `json:"actor_id"`
+	ChirpID   *uuid.UUID `json:"chirp_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Read      bool       `json:"read"`
+}
+
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	UnreadCount   int64          `json:"unread_count"`
+	NextCursor    string         `json:"next_cursor,omitempty"`
+}
+
+func (srv *Server) GetNotifications(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		return err
+	}
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	dbNotifications, err := srv.db.ListNotifications(r.Context(), database.ListNotificationsParams{
+		UserID:          parsedUserID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        page.rowLimit(),
+	})
+	if err != nil {
+		srv.logger.Error("Error listing notifications", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	unread, err := srv.db.CountUnreadNotifications(r.Context(), parsedUserID)
+	if err != nil {
+		srv.logger.Error("Error counting unread notifications", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	dbNotifications, nextCursor := paginate(dbNotifications, page, func(n database.Notification) pageCursor {
+		return pageCursor{CreatedAt: n.CreatedAt, ID: n.ID}
+	})
+
+	notifications := make([]Notification, 0, len(dbNotifications))
+	for _, n := range dbNotifications {
+		notifications = append(notifications, mapDbNotification(n))
+	}
+
+	return respondWithJSON(w, http.StatusOK, NotificationPage{
+		Notifications: notifications,
+		UnreadCount:   unread,
+		NextCursor:    nextCursor,
+	})
+}
+
+// MarkNotificationsRead marks the given notifications as read.
+// When no ids are given, every notification of the user is marked as read.
+func (srv *Server) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		IDs []uuid.UUID `json:"ids"`
+	}
+
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	payload := input{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			srv.logger.Error("Error decoding JSON body", "err", err)
+			return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+		}
+	}
+
+	var (
+		marked int64
+		err    error
+	)
+	if len(payload.IDs) == 0 {
+		marked, err = srv.db.MarkAllNotificationsRead(r.Context(), parsedUserID)
+	} else {
+		marked, err = srv.db.MarkNotificationsRead(r.Context(), database.MarkNotificationsReadParams{
+			UserID: parsedUserID,
+			Ids:    payload.IDs,
+		})
+	}
+	if err != nil {
+		srv.logger.Error("Error marking notifications as read", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	srv.logger.Info("Marked notifications as read", "user_id", parsedUserID, "count", marked)
+	respondWithNoContent(w)
+	return nil
+}
+
+func mapDbNotification(n database.Notification) Notification {
+	notification := Notification{
+		ID:        n.ID,
+		Type:      n.Type,
+		ActorID:   n.ActorID,
+		CreatedAt: n.CreatedAt,
+		Read:      n.ReadAt.Valid,
+	}
+	if n.ChirpID.Valid {
+		notification.ChirpID = &n.ChirpID.UUID
+	}
+	return notification
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/mail"
+)
+
+const passwordResetTokenTTL = time.Hour
+
+// ForgotPassword emails a password reset token to the owner of the given address.
+// It always responds with 202 Accepted so that it cannot be used to find out which emails are registered.
+func (srv *Server) ForgotPassword(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	payload := input{}
+	if err := decoder.Decode(&payload); err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+	}
+	if payload.Email == "" {
+		return APIError{Status: http.StatusBadRequest, Msg: "Email cannot be empty"}
+	}
+
+	// the account is looked up and mailed after responding, so the response time does not
+	// depend on whether the email is registered
+	ctx := context.WithoutCancel(r.Context())
+	srv.background.Add(1)
+	go func() {
+		defer srv.background.Done()
+		srv.requestPasswordReset(ctx, payload.Email)
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// ResetPassword sets a new password using a token sent by ForgotPassword.
+// Every session of the user is signed out by revoking their refresh tokens.
+func (srv *Server) ResetPassword(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	payload := input{}
+	if err := decoder.Decode(&payload); err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+	}
+	if payload.Token == "" {
+		return APIError{Status: http.StatusBadRequest, Msg: "Token cannot be empty"}
+	}
+	if payload.Password == "" {
+		return APIError{Status: http.StatusBadRequest, Msg: "Password cannot be empty"}
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.Password)
+	if err != nil {
+		srv.logger.Error("Error hashing user password", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	// the token is consumed in the same transaction as the password change, so it can be used again
+	// when the change fails
+	var userID uuid.UUID
+	var revoked int64
+	err = srv.withTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		userID, err = q.ConsumePasswordResetToken(r.Context(), auth.HashToken(payload.Token))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return APIError{Status: http.StatusBadRequest, Msg: "Reset token is invalid or has expired"}
+			}
+			srv.logger.Error("Error consuming password reset token", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+
+		if err := q.InvalidatePasswordResetTokens(r.Context(), userID); err != nil {
+			srv.logger.Error("Error invalidating password reset tokens", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		revoked, err = q.RevokeAllRefreshTokensForUser(r.Context(), userID)
+		if err != nil {
+			srv.logger.Error("Error revoking refresh tokens", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+
+		_, err = q.UpdateUser(r.Context(), database.UpdateUserParams{
+			ID:             userID,
+			HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+		})
+		if err != nil {
+			srv.logger.Error("Error updating user password", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		return nil
+	})
+	if _, ok := err.(APIError); err != nil && !ok {
+		srv.logger.Error("Error committing password reset", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if err != nil {
+		return err
+	}
+
+	srv.logger.Info("Password reset", "user_id", userID, "revoked_refresh_tokens", revoked)
+	respondWithNoContent(w)
+	return nil
+}
+
+// requestPasswordReset sends a password reset email if the address belongs to a user.
+// Errors are only logged, as the client has already been answered.
+func (srv *Server) requestPasswordReset(ctx context.Context, email string) {
+	user, err := srv.db.GetUserByEmail(ctx, email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		srv.logger.Info("Password reset requested for an unknown email")
+	case err != nil:
+		srv.logger.Error("Error getting user", "err", err)
+	default:
+		if err := srv.sendPasswordResetEmail(ctx, user); err != nil {
+			srv.logger.Error("Error sending password reset email", "user_id", user.ID, "err", err)
+		}
+	}
+}
+
+// sendPasswordResetEmail issues a new password reset token and mails it to the user.
+// Tokens issued earlier are invalidated.
+func (srv *Server) sendPasswordResetEmail(ctx context.Context, user database.User) error {
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("generating password reset token: %w", err)
+	}
+
+	if err := srv.db.InvalidatePasswordResetTokens(ctx, user.ID); err != nil {
+		return fmt.Errorf("invalidating previous password reset tokens: %w", err)
+	}
+	err = srv.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetTokenTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("storing password reset token: %w", err)
+	}
+
+	body := fmt.Sprintf("Use the following token to reset your Chirpy password: %s\n", token)
+	if srv.cfg.BaseURL != "" {
+		body = fmt.Sprintf("Open the following link to reset your Chirpy password:\n%s/reset-password?token=%s\n", srv.cfg.BaseURL, token)
+	}
+	body += fmt.Sprintf("\nThe token expires in %s. If you did not request a password reset, you can ignore this email.\n", passwordResetTokenTTL)
+
+	return srv.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body:    body,
+	})
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestForgotPassword(t *testing.T) {
+	tests := []struct {
+		name  string
+		known bool
+	}{
+		{name: "known email", known: true},
+		{name: "unknown email is not revealed", known: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+			mailer := &recordingMailer{}
+			srv.mailer = mailer
+
+			userID := uuid.New()
+			query := mock.ExpectQuery("SELECT (.+) FROM users").WithArgs("alice@example.com")
+			if tt.known {
+				query.WillReturnRows(sqlmock.NewRows(userColumns).AddRow(mockUserRow(userID, "alice@example.com", "hash")...))
+				mock.ExpectExec("UPDATE password_reset_tokens").
+					WithArgs(userID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("INSERT INTO password_reset_tokens").
+					WithArgs(sqlmock.AnyArg(), userID, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			} else {
+				query.WillReturnError(sql.ErrNoRows)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/password/forgot", strings.NewReader(`{"email": "alice@example.com"}`))
+			w := httptest.NewRecorder()
+			if err := srv.ForgotPassword(w, req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := srv.Shutdown(t.Context()); err != nil {
+				t.Fatalf("Shutdown() error = %v", err)
+			}
+
+			if w.Code != http.StatusAccepted {
+				t.Errorf("expected status %d, got %d", http.StatusAccepted, w.Code)
+			}
+			wantSent := 0
+			if tt.known {
+				wantSent = 1
+			}
+			if len(mailer.sent) != wantSent {
+				t.Errorf("expected %d emails to be sent, got %d", wantSent, len(mailer.sent))
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		validToken     bool
+		expectConsume  bool
+		updateFails    bool
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "happy path",
+			requestBody:    `{"token": "secret", "password": "new"}`,
+			validToken:     true,
+			expectConsume:  true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "failed update keeps the token",
+			requestBody:    `{"token": "secret", "password": "new"}`,
+			validToken:     true,
+			expectConsume:  true,
+			updateFails:    true,
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "Internal Server Error",
+		},
+		{
+			name:           "invalid or expired token",
+			requestBody:    `{"token": "secret", "password": "new"}`,
+			expectConsume:  true,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Reset token is invalid or has expired",
+		},
+		{
+			name:           "empty password",
+			requestBody:    `{"token": "secret", "password": ""}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Password cannot be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID := uuid.New()
+			if tt.expectConsume {
+				mock.ExpectBegin()
+				query := mock.ExpectQuery("UPDATE password_reset_tokens").WithArgs(auth.HashToken("secret"))
+				if tt.validToken {
+					query.WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID))
+				} else {
+					query.WillReturnError(sql.ErrNoRows)
+					mock.ExpectRollback()
+				}
+			}
+			if tt.validToken {
+				mock.ExpectExec("UPDATE password_reset_tokens").
+					WithArgs(userID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("UPDATE refresh_tokens").
+					WithArgs(userID).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				if tt.updateFails {
+					mock.ExpectQuery("UPDATE users").WillReturnError(errors.New("connection reset"))
+					// the consumed token and the revoked sessions are restored by the rollback
+					mock.ExpectRollback()
+				} else {
+					mock.ExpectQuery("UPDATE users").
+						WillReturnRows(sqlmock.NewRows(userColumns).AddRow(mockUserRow(userID, "alice@example.com", "hash")...))
+					mock.ExpectCommit()
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/password/reset", strings.NewReader(tt.requestBody))
+			w := httptest.NewRecorder()
+			err = srv.ResetPassword(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
@@ -1,54 +1,96 @@
 package server
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 
-	"time"
-
 	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/database"
 )
 
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// The presented refresh token is revoked. Presenting it again is treated as a sign that it was stolen:
+// every token descending from the same login is revoked.
 func (srv *Server) Refresh(w http.ResponseWriter, r *http.Request) error {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
 	}
+	tokenHash := auth.HashToken(token)
 
-	refreshToken, err := srv.db.GetRefreshToken(r.Context(), token)
+	newToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+		srv.logger.Error("Error issuing refresh token", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
 
-	if time.Now().UTC().After(refreshToken.ExpiresAt) {
+	refreshToken, err := srv.db.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		NewTokenHash: auth.HashToken(newToken),
+		TokenHash:    tokenHash,
+		UserAgent:    sql.NullString{String: userAgent(r), Valid: r.UserAgent() != ""},
+		IpAddress:    sql.NullString{String: srv.clientIP(r), Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		srv.detectRefreshTokenReuse(r, tokenHash)
 		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
 	}
-
-	if refreshToken.RevokedAt.Valid {
-		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	if err != nil {
+		srv.logger.Error("Error rotating refresh token", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
 
-	accessToken, err := auth.MakeJWT(refreshToken.UserID, srv.cfg.TokenSecret, accessTokenExpirationTime)
+	accessToken, err := auth.MakeJWT(refreshToken.UserID, auth.AllScopes, srv.keys, accessTokenExpirationTime)
 	if err != nil {
 		srv.logger.Error("Error issuing user token", "err", err)
 		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
 
 	return respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newToken,
 	})
 }
 
+// detectRefreshTokenReuse revokes the whole token family when a refresh token that has already been
+// rotated is presented again, since either the legitimate client or an attacker holds a stolen copy.
+func (srv *Server) detectRefreshTokenReuse(r *http.Request, tokenHash string) {
+	refreshToken, err := srv.db.GetRefreshToken(r.Context(), tokenHash)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			srv.logger.Error("Error getting refresh token", "err", err)
+		}
+		return
+	}
+	if !refreshToken.ReplacedBy.Valid {
+		return
+	}
+
+	revoked, err := srv.db.RevokeRefreshTokenFamily(r.Context(), refreshToken.FamilyID)
+	if err != nil {
+		srv.logger.Error("Error revoking refresh token family", "family_id", refreshToken.FamilyID, "err", err)
+		return
+	}
+	srv.logger.Warn("Refresh token reuse detected, revoked token family",
+		"user_id", refreshToken.UserID,
+		"family_id", refreshToken.FamilyID,
+		"revoked_tokens", revoked,
+		"remote_addr", r.RemoteAddr,
+	)
+}
+
 func (srv *Server) Revoke(w http.ResponseWriter, r *http.Request) error {
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
 	}
 
-	if err := srv.db.RevokeRefreshToken(r.Context(), token); err != nil {
+	if err := srv.db.RevokeRefreshToken(r.Context(), auth.HashToken(token)); err != nil {
 		srv.logger.Error("Error revoking refresh token", "err", err)
 		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+// refreshTokenColumns lists the columns of the refresh_tokens table in the order queries return them.
+var refreshTokenColumns = []string{"created_at", "updated_at", "user_id", "expires_at", "revoked_at", "token_hash", "family_id", "replaced_by", "user_agent", "ip_address", "last_used_at", "device_label"}
+
+// mockRefreshTokenRow returns a valid refresh_tokens row. replacedBy is only set when not empty.
+func mockRefreshTokenRow(userID, familyID uuid.UUID, tokenHash, replacedBy string) []driver.Value {
+	row := []driver.Value{time.Now(), time.Now(), userID, time.Now().Add(time.Hour), nil, tokenHash, familyID, nil, "Mozilla/5.0", "192.0.2.1", time.Now(), "Firefox on Linux"}
+	if replacedBy != "" {
+		row[4], row[7] = time.Now(), replacedBy
+	}
+	return row
+}
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name           string
+		rotated        bool
+		known          bool
+		reused         bool
+		expectedStatus int
+	}{
+		{
+			name:           "rotates the refresh token",
+			rotated:        true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "reused token revokes the family",
+			known:          true,
+			reused:         true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "revoked token",
+			known:          true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{TokenSecret: "secret"}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID, familyID := uuid.New(), uuid.New()
+			tokenHash := auth.HashToken("old-token")
+			rotate := mock.ExpectQuery("WITH rotated AS").WithArgs(sqlmock.AnyArg(), tokenHash, sqlmock.AnyArg(), sqlmock.AnyArg())
+			if tt.rotated {
+				rotate.WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+					AddRow(mockRefreshTokenRow(userID, familyID, "new-hash", "")...))
+			} else {
+				rotate.WillReturnError(sql.ErrNoRows)
+				lookup := mock.ExpectQuery("SELECT (.+) FROM refresh_tokens").WithArgs(tokenHash)
+				switch {
+				case tt.reused:
+					lookup.WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+						AddRow(mockRefreshTokenRow(userID, familyID, tokenHash, "new-hash")...))
+					mock.ExpectExec("UPDATE refresh_tokens").
+						WithArgs(familyID).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				case tt.known:
+					row := mockRefreshTokenRow(userID, familyID, tokenHash, "")
+					row[4] = time.Now()
+					lookup.WillReturnRows(sqlmock.NewRows(refreshTokenColumns).AddRow(row...))
+				default:
+					lookup.WillReturnError(sql.ErrNoRows)
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+			req.Header.Set("Authorization", "Bearer old-token")
+			w := httptest.NewRecorder()
+			err = srv.Refresh(w, req)
+
+			if tt.expectedStatus != http.StatusOK {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				var response struct {
+					Token        string `json:"token"`
+					RefreshToken string `json:"refresh_token"`
+				}
+				if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if response.Token == "" || response.RefreshToken == "" || response.RefreshToken == "old-token" {
+					t.Errorf("expected a new access token and refresh token, got %+v", response)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
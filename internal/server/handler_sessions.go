@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+// Session is a signed in device of a user. Its ID identifies the refresh token family
+// started by the login, so it stays the same across refresh token rotations.
+type Session struct {
+	ID          uuid.UUID  `json:"id"`
+	DeviceLabel string     `json:"device_label"`
+	UserAgent   string     `json:"user_agent,omitempty"`
+	IPAddress   string     `json:"ip_address,omitempty"`
+	SignedInAt  time.Time  `json:"signed_in_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+func (srv *Server) GetSessions(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	rows, err := srv.db.ListSessions(r.Context(), parsedUserID)
+	if err != nil {
+		srv.logger.Error("Error listing sessions", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	sessions := make([]Session, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, mapDbSession(row))
+	}
+	return respondWithJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession signs out a single device by revoking its refresh tokens.
+// Access tokens already issued to the device stay valid until they expire.
+func (srv *Server) RevokeSession(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	revoked, err := srv.db.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionID,
+		UserID:   parsedUserID,
+	})
+	if err != nil {
+		srv.logger.Error("Error revoking session", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if revoked == 0 {
+		return APIError{Status: http.StatusNotFound, Msg: "Session with given id has not been found"}
+	}
+
+	respondWithNoContent(w)
+	return nil
+}
+
+// RevokeAllSessions signs out every device of the user, including the one making the request.
+func (srv *Server) RevokeAllSessions(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	revoked, err := srv.db.RevokeAllRefreshTokensForUser(r.Context(), parsedUserID)
+	if err != nil {
+		srv.logger.Error("Error revoking refresh tokens", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	srv.logger.Info("Revoked all sessions", "user_id", parsedUserID, "count", revoked)
+	respondWithNoContent(w)
+	return nil
+}
+
+func mapDbSession(row database.ListSessionsRow) Session {
+	session := Session{
+		ID:          row.FamilyID,
+		DeviceLabel: row.DeviceLabel.String,
+		UserAgent:   row.UserAgent.String,
+		IPAddress:   row.IpAddress.String,
+		SignedInAt:  row.SignedInAt,
+		ExpiresAt:   row.ExpiresAt,
+	}
+	if row.LastUsedAt.Valid {
+		session.LastUsedAt = &row.LastUsedAt.Time
+	}
+	return session
+}
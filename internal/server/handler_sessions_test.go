@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestGetSessions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	userID, familyID := uuid.New(), uuid.New()
+	mock.ExpectQuery("FROM refresh_tokens").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"family_id", "device_label", "user_agent", "ip_address", "last_used_at", "expires_at", "signed_in_at"}).
+			AddRow(familyID, "Firefox on Linux", "Mozilla/5.0", "192.0.2.1", time.Now(), time.Now().Add(time.Hour), time.Now().Add(-time.Hour)))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+	w := httptest.NewRecorder()
+	if err := srv.GetSessions(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var sessions []Session
+	if err := json.NewDecoder(w.Body).Decode(&sessions); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != familyID || sessions[0].DeviceLabel != "Firefox on Linux" || sessions[0].LastUsedAt == nil {
+		t.Errorf("unexpected sessions %+v", sessions)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	tests := []struct {
+		name           string
+		sessionID      string
+		revoked        int64
+		expectQuery    bool
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "happy path",
+			sessionID:      uuid.NewString(),
+			revoked:        1,
+			expectQuery:    true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "session of another user or already revoked",
+			sessionID:      uuid.NewString(),
+			expectQuery:    true,
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "Session with given id has not been found",
+		},
+		{
+			name:           "invalid id",
+			sessionID:      "not-a-uuid",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Error parsing UUID: invalid UUID length: 10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID := uuid.New()
+			if tt.expectQuery {
+				mock.ExpectExec("UPDATE refresh_tokens").
+					WithArgs(uuid.MustParse(tt.sessionID), userID).
+					WillReturnResult(sqlmock.NewResult(0, tt.revoked))
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/sessions/"+tt.sessionID, nil)
+			req.SetPathValue("sessionID", tt.sessionID)
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+			w := httptest.NewRecorder()
+			err = srv.RevokeSession(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
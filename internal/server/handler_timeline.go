@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+// GetTimeline returns chirps posted by the users the authenticated user follows, newest first.
+func (srv *Server) GetTimeline(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		return err
+	}
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	dbChirps, err := srv.db.ListTimelineChirps(r.Context(), database.ListTimelineChirpsParams{
+		UserID:          parsedUserID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        page.rowLimit(),
+	})
+	if err != nil {
+		srv.logger.Error("Error getting timeline chirps", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	dbChirps, nextCursor := paginate(dbChirps, page, chirpCursor)
+	chirps := mapDbChirps(dbChirps)
+	if err := srv.withLikeStats(r.Context(), chirpRefs(chirps)...); err != nil {
+		srv.logger.Error("Error getting chirp likes", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	return respondWithJSON(w, http.StatusOK, ChirpPage{
+		Chirps:     chirps,
+		NextCursor: nextCursor,
+	})
+}
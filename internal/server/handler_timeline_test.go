@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+// chirpColumns lists the columns of the chirps table in the order queries return them.
+var chirpColumns = []string{"id", "created_at", "updated_at", "body", "user_id", "in_reply_to", "deleted_at"}
+
+func TestGetTimeline(t *testing.T) {
+	userID := uuid.New()
+	authorID := uuid.New()
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	chirpIDs := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	cursor := pageCursor{CreatedAt: base, ID: chirpIDs[0]}
+
+	tests := []struct {
+		name           string
+		userID         any
+		query          string
+		cursorID       any
+		rows           int
+		expectedStatus int
+		expectedError  string
+		wantChirps     int
+		wantNextCursor bool
+	}{
+		{
+			name:           "first page with more results",
+			userID:         userID,
+			query:          "?limit=2",
+			cursorID:       nil,
+			rows:           3,
+			expectedStatus: http.StatusOK,
+			wantChirps:     2,
+			wantNextCursor: true,
+		},
+		{
+			name:           "continue from cursor",
+			userID:         userID,
+			query:          "?limit=2&cursor=" + encodeCursor(cursor),
+			cursorID:       cursor.ID,
+			rows:           2,
+			expectedStatus: http.StatusOK,
+			wantChirps:     2,
+		},
+		{
+			name:           "invalid cursor",
+			userID:         userID,
+			query:          "?cursor=not-a-cursor",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid cursor",
+		},
+		{
+			name:           "unauthenticated",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "Unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			if tt.rows > 0 {
+				rows := sqlmock.NewRows(chirpColumns)
+				for i := 0; i < tt.rows; i++ {
+					createdAt := base.Add(-time.Duration(i) * time.Minute)
+					rows.AddRow(chirpIDs[i], createdAt, createdAt, "chirp", authorID, nil, nil)
+				}
+				mock.ExpectQuery("JOIN follows ON follows.followee_id = chirps.user_id").
+					WithArgs(userID, sqlmock.AnyArg(), tt.cursorID, int32(3)).
+					WillReturnRows(rows)
+				mock.ExpectQuery("FROM chirp_likes").
+					WillReturnRows(sqlmock.NewRows([]string{"chirp_id", "like_count", "liked_by_me"}).
+						AddRow(chirpIDs[0], 2, true))
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/timeline"+tt.query, nil)
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, tt.userID))
+			w := httptest.NewRecorder()
+			err = srv.GetTimeline(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var response ChirpPage
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(response.Chirps) != tt.wantChirps {
+				t.Errorf("expected %d chirps, got %d", tt.wantChirps, len(response.Chirps))
+			}
+			for _, c := range response.Chirps {
+				if c.LikedByMe == nil {
+					t.Fatalf("expected liked_by_me to be set for authenticated requests")
+				}
+				if want := c.ID == chirpIDs[0]; *c.LikedByMe != want {
+					t.Errorf("expected chirp %v liked_by_me %v, got %v", c.ID, want, *c.LikedByMe)
+				}
+			}
+			if (response.NextCursor != "") != tt.wantNextCursor {
+				t.Errorf("expected next cursor presence %v, got %q", tt.wantNextCursor, response.NextCursor)
+			}
+			if tt.wantNextCursor {
+				next, err := decodeCursor(response.NextCursor)
+				if err != nil {
+					t.Fatalf("failed to decode next cursor: %v", err)
+				}
+				last := response.Chirps[len(response.Chirps)-1]
+				if next.ID != last.ID || !next.CreatedAt.Equal(last.CreatedAt) {
+					t.Errorf("expected cursor to point at the last chirp %v, got %v", last.ID, next.ID)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
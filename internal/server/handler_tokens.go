@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+)
+
+const (
+	defaultScopedTokenExpirationTime time.Duration = time.Hour
+	maxScopedTokenExpirationTime     time.Duration = 24 * time.Hour
+)
+
+// CreateScopedToken issues an access token limited to the requested scopes, e.g. for a bot posting chirps.
+// Scoped tokens cannot manage the account and, like every access token, cannot be revoked before they expire.
+func (srv *Server) CreateScopedToken(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		Scopes           []string `json:"scopes"`
+		ExpiresInSeconds int      `json:"expires_in_seconds"`
+	}
+	type response struct {
+		Token     string    `json:"token"`
+		Scopes    []string  `json:"scopes"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	payload := input{}
+	if err := decoder.Decode(&payload); err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+	}
+
+	if err := validateDelegatedScopes(payload.Scopes); err != nil {
+		return err
+	}
+
+	expiresIn := defaultScopedTokenExpirationTime
+	if payload.ExpiresInSeconds != 0 {
+		expiresIn = time.Duration(payload.ExpiresInSeconds) * time.Second
+		if expiresIn < 0 || expiresIn > maxScopedTokenExpirationTime {
+			return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Expiration must be between 1 and %d seconds", int(maxScopedTokenExpirationTime.Seconds()))}
+		}
+	}
+
+	// the token carries whole seconds, the response reports the same instant
+	expiresAt := time.Now().UTC().Add(expiresIn).Truncate(time.Second)
+	token, err := auth.MakeJWTExpiringAt(parsedUserID, payload.Scopes, srv.keys, expiresAt)
+	if err != nil {
+		srv.logger.Error("Error issuing scoped token", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	srv.logger.Info("Issued scoped token", "user_id", parsedUserID, "scopes", payload.Scopes, "expires_in", expiresIn)
+	return respondWithJSON(w, http.StatusCreated, response{
+		Token:     token,
+		Scopes:    payload.Scopes,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// validateDelegatedScopes checks the scopes requested for a scoped token or an API key.
+// Credentials handed to bots and integrations can never manage the account.
+func validateDelegatedScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return APIError{Status: http.StatusBadRequest, Msg: "At least one scope is required"}
+	}
+	for _, scope := range scopes {
+		if !auth.IsValidScope(scope) {
+			return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Unknown scope: %q", scope)}
+		}
+		if scope == auth.ScopeAccountManage {
+			return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Scope %q cannot be delegated", scope)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestCreateScopedToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedError  string
+		expectedScopes []string
+		expectedTTL    time.Duration
+	}{
+		{
+			name:           "happy path",
+			body:           `{"scopes": ["chirps:write"]}`,
+			expectedStatus: http.StatusCreated,
+			expectedScopes: []string{auth.ScopeChirpsWrite},
+			expectedTTL:    time.Hour,
+		},
+		{
+			name:           "custom expiration",
+			body:           `{"scopes": ["chirps:read", "users:read"], "expires_in_seconds": 86400}`,
+			expectedStatus: http.StatusCreated,
+			expectedScopes: []string{auth.ScopeChirpsRead, auth.ScopeUsersRead},
+			expectedTTL:    24 * time.Hour,
+		},
+		{
+			name:           "no scopes",
+			body:           `{"scopes": []}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "At least one scope is required",
+		},
+		{
+			name:           "unknown scope",
+			body:           `{"scopes": ["admin"]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `Unknown scope: "admin"`,
+		},
+		{
+			name:           "account management",
+			body:           `{"scopes": ["account:manage"]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `Scope "account:manage" cannot be delegated`,
+		},
+		{
+			name:           "malformed body",
+			body:           `{"scopes": `,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Error decoding JSON body: unexpected EOF",
+		},
+		{
+			name:           "expiration too long",
+			body:           `{"scopes": ["chirps:write"], "expires_in_seconds": 86401}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Expiration must be between 1 and 86400 seconds",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewServer(&config.Config{TokenSecret: "secret"}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID := uuid.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+			w := httptest.NewRecorder()
+			err = srv.CreateScopedToken(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var resp struct {
+				Token     string    `json:"token"`
+				ExpiresAt time.Time `json:"expires_at"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			claims, err := auth.ValidateJWT(resp.Token, srv.keys)
+			if err != nil {
+				t.Fatalf("failed to validate issued token: %v", err)
+			}
+			if claims.UserID != userID {
+				t.Errorf("expected token for user %s, got %s", userID, claims.UserID)
+			}
+			if strings.Join(claims.Scopes, " ") != strings.Join(tt.expectedScopes, " ") {
+				t.Errorf("expected scopes %v, got %v", tt.expectedScopes, claims.Scopes)
+			}
+			if ttl := time.Until(claims.ExpiresAt); ttl > tt.expectedTTL || ttl < tt.expectedTTL-time.Minute {
+				t.Errorf("expected token to expire in %s, got %s", tt.expectedTTL, ttl)
+			}
+			if !resp.ExpiresAt.Equal(claims.ExpiresAt) {
+				t.Errorf("expected expires_at %s to match the token expiration %s", resp.ExpiresAt, claims.ExpiresAt)
+			}
+		})
+	}
+}
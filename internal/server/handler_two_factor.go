@@ -0,0 +1,344 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+const (
+	totpIssuer                string        = "Chirpy"
+	recoveryCodeCount         int           = 10
+	loginChallengeTTL         time.Duration = 5 * time.Minute
+	maxLoginChallengeAttempts int32         = 5
+)
+
+// LoginChallenge is returned by Login instead of tokens when the user has two-factor authentication enabled.
+// The challenge token has to be exchanged together with a second factor at POST /api/login/2fa.
+type LoginChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// EnrollTwoFactor generates a new TOTP secret for the user.
+// Two-factor authentication is only enabled once a code generated from the secret is confirmed.
+func (srv *Server) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	type response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	user, err := srv.currentUser(r)
+	if err != nil {
+		return err
+	}
+	if user.TotpEnabledAt.Valid {
+		return APIError{Status: http.StatusConflict, Msg: "Two-factor authentication is already enabled"}
+	}
+
+	payload := input{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+	}
+	if err := auth.CheckPasswordHash(payload.CurrentPassword, user.HashedPassword); err != nil {
+		srv.logger.Info("User provided password does not match the hash stored in the database", "err", err)
+		return APIError{Status: http.StatusUnauthorized, Msg: "Incorrect current password"}
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		srv.logger.Error("Error generating TOTP secret", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	updated, err := srv.db.SetTOTPSecret(r.Context(), database.SetTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		srv.logger.Error("Error saving TOTP secret", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if updated == 0 {
+		return APIError{Status: http.StatusConflict, Msg: "Two-factor authentication is already enabled"}
+	}
+
+	account := user.Email
+	if user.Username.Valid {
+		account = user.Username.String
+	}
+	return respondWithJSON(w, http.StatusOK, response{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, totpIssuer, account),
+	})
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user proves their authenticator
+// generates valid codes, and returns a fresh set of recovery codes. They are only ever shown once.
+func (srv *Server) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	user, err := srv.currentUser(r)
+	if err != nil {
+		return err
+	}
+	if user.TotpEnabledAt.Valid {
+		return APIError{Status: http.StatusConflict, Msg: "Two-factor authentication is already enabled"}
+	}
+	if !user.TotpSecret.Valid {
+		return APIError{Status: http.StatusBadRequest, Msg: "Two-factor authentication enrollment has not been started"}
+	}
+
+	payload := input{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+	}
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, payload.Code, time.Now())
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Invalid two-factor authentication code"}
+	}
+
+	// recovery codes are created in the same transaction, so two-factor authentication is never
+	// enabled without them
+	var codes []string
+	err = srv.withTx(r.Context(), func(q *database.Queries) error {
+		enabled, err := q.EnableTOTP(r.Context(), database.EnableTOTPParams{
+			ID:           user.ID,
+			TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+		})
+		if err != nil {
+			srv.logger.Error("Error enabling two-factor authentication", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		if enabled == 0 {
+			return APIError{Status: http.StatusConflict, Msg: "Two-factor authentication is already enabled"}
+		}
+
+		codes, err = replaceRecoveryCodes(r.Context(), q, user.ID)
+		if err != nil {
+			srv.logger.Error("Error creating recovery codes", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		return nil
+	})
+	if _, ok := err.(APIError); err != nil && !ok {
+		srv.logger.Error("Error committing two-factor authentication", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if err != nil {
+		return err
+	}
+
+	srv.logger.Info("Two-factor authentication enabled", "user_id", user.ID)
+	return respondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
+
+func (srv *Server) DisableTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	user, err := srv.currentUser(r)
+	if err != nil {
+		return err
+	}
+
+	payload := input{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+	}
+	if err := auth.CheckPasswordHash(payload.CurrentPassword, user.HashedPassword); err != nil {
+		srv.logger.Info("User provided password does not match the hash stored in the database", "err", err)
+		return APIError{Status: http.StatusUnauthorized, Msg: "Incorrect current password"}
+	}
+
+	err = srv.withTx(r.Context(), func(q *database.Queries) error {
+		if err := q.DisableTOTP(r.Context(), user.ID); err != nil {
+			return fmt.Errorf("disabling two-factor authentication: %w", err)
+		}
+		if err := q.DeleteRecoveryCodes(r.Context(), user.ID); err != nil {
+			return fmt.Errorf("deleting recovery codes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		srv.logger.Error("Error disabling two-factor authentication", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	srv.logger.Info("Two-factor authentication disabled", "user_id", user.ID)
+	respondWithNoContent(w)
+	return nil
+}
+
+// LoginTwoFactor completes a login by exchanging a challenge token issued by Login
+// together with either a TOTP code or a recovery code for an access and refresh token pair.
+func (srv *Server) LoginTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+		DeviceLabel    string `json:"device_label"`
+	}
+
+	payload := input{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+	}
+	if payload.ChallengeToken == "" {
+		return APIError{Status: http.StatusBadRequest, Msg: "Challenge token cannot be empty"}
+	}
+	if payload.Code == "" && payload.RecoveryCode == "" {
+		return APIError{Status: http.StatusBadRequest, Msg: "Two-factor authentication code cannot be empty"}
+	}
+
+	challengeHash := auth.HashToken(payload.ChallengeToken)
+	userID, err := srv.db.AttemptLoginChallenge(r.Context(), database.AttemptLoginChallengeParams{
+		TokenHash: challengeHash,
+		Attempts:  maxLoginChallengeAttempts,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIError{Status: http.StatusUnauthorized, Msg: "Login challenge is invalid or has expired"}
+		}
+		srv.logger.Error("Error checking login challenge", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	user, err := srv.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		srv.logger.Error("Error getting user", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if !user.TotpEnabledAt.Valid {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Login challenge is invalid or has expired"}
+	}
+
+	ok, err := srv.checkSecondFactor(r.Context(), user, payload.Code, payload.RecoveryCode)
+	if err != nil {
+		srv.logger.Error("Error checking second factor", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if !ok {
+		srv.logger.Info("Invalid second factor provided", "user_id", user.ID)
+		return APIError{Status: http.StatusUnauthorized, Msg: "Invalid two-factor authentication code"}
+	}
+
+	consumed, err := srv.db.ConsumeLoginChallenge(r.Context(), challengeHash)
+	if err != nil {
+		srv.logger.Error("Error consuming login challenge", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if consumed == 0 {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Login challenge is invalid or has expired"}
+	}
+
+	session, err := srv.startSession(r, user, payload.DeviceLabel)
+	if err != nil {
+		srv.logger.Error("Error starting session", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	return respondWithJSON(w, http.StatusOK, session)
+}
+
+// createLoginChallenge issues a short-lived challenge the user has to answer with their second factor.
+func (srv *Server) createLoginChallenge(ctx context.Context, user database.User) (LoginChallenge, error) {
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return LoginChallenge{}, fmt.Errorf("generating challenge token: %w", err)
+	}
+
+	expiresAt := time.Now().UTC().Add(loginChallengeTTL)
+	err = srv.db.CreateLoginChallenge(ctx, database.CreateLoginChallengeParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return LoginChallenge{}, fmt.Errorf("storing challenge token: %w", err)
+	}
+
+	return LoginChallenge{TwoFactorRequired: true, ChallengeToken: token, ExpiresAt: expiresAt}, nil
+}
+
+// checkSecondFactor verifies a TOTP code, or a recovery code when no TOTP code is given.
+// Both can only be used once.
+func (srv *Server) checkSecondFactor(ctx context.Context, user database.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		used, err := srv.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			ID:           user.ID,
+			TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+		})
+		return used > 0, err
+	}
+
+	used, err := srv.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   user.ID,
+		CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+	})
+	if used > 0 {
+		srv.logger.Info("Recovery code used", "user_id", user.ID)
+	}
+	return used > 0, err
+}
+
+// replaceRecoveryCodes generates a new set of recovery codes, invalidating any previous ones.
+func replaceRecoveryCodes(ctx context.Context, q *database.Queries, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := auth.MakeRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, auth.HashToken(auth.NormalizeRecoveryCode(code)))
+	}
+
+	if err := q.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := q.CreateRecoveryCodes(ctx, database.CreateRecoveryCodesParams{
+		UserID:     userID,
+		CodeHashes: hashes,
+	}); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// currentUser loads the authenticated user making the request.
+func (srv *Server) currentUser(r *http.Request) (database.User, error) {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return database.User{}, APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	user, err := srv.db.GetUserByID(r.Context(), parsedUserID)
+	if err != nil {
+		srv.logger.Error("Error getting user", "err", err)
+		return database.User{}, APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	return user, nil
+}
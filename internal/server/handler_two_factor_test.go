@@ -0,0 +1,388 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestLoginTwoFactor(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("failed to generate TOTP secret: %v", err)
+	}
+	code, err := auth.GenerateTOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatalf("failed to generate TOTP code: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		checkChallenge bool
+		openChallenge  bool
+		expectTOTP     bool
+		expectRecovery bool
+		replayed       bool
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "totp code",
+			requestBody:    `{"challenge_token": "challenge", "code": "` + code + `"}`,
+			checkChallenge: true,
+			openChallenge:  true,
+			expectTOTP:     true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "recovery code",
+			requestBody:    `{"challenge_token": "challenge", "recovery_code": "ABCD-efgh-ijkl-mnop"}`,
+			checkChallenge: true,
+			openChallenge:  true,
+			expectRecovery: true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "replayed totp code",
+			requestBody:    `{"challenge_token": "challenge", "code": "` + code + `"}`,
+			checkChallenge: true,
+			openChallenge:  true,
+			expectTOTP:     true,
+			replayed:       true,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "Invalid two-factor authentication code",
+		},
+		{
+			name:           "wrong totp code",
+			requestBody:    `{"challenge_token": "challenge", "code": "abcdef"}`,
+			checkChallenge: true,
+			openChallenge:  true,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "Invalid two-factor authentication code",
+		},
+		{
+			name:           "expired or exhausted challenge",
+			requestBody:    `{"challenge_token": "challenge", "code": "` + code + `"}`,
+			checkChallenge: true,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "Login challenge is invalid or has expired",
+		},
+		{
+			name:           "missing code",
+			requestBody:    `{"challenge_token": "challenge"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Two-factor authentication code cannot be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{TokenSecret: "secret"}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID := uuid.New()
+			challengeHash := auth.HashToken("challenge")
+			if tt.checkChallenge {
+				query := mock.ExpectQuery("UPDATE login_challenges").WithArgs(challengeHash, maxLoginChallengeAttempts)
+				if tt.openChallenge {
+					query.WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID))
+					userRow := mockUserRow(userID, "alice@example.com", "hash")
+					userRow[userTotpSecretColumn], userRow[userTotpEnabledAtColumn] = secret, time.Now()
+					mock.ExpectQuery("SELECT (.+) FROM users").
+						WithArgs(userID).
+						WillReturnRows(sqlmock.NewRows(userColumns).AddRow(userRow...))
+				} else {
+					query.WillReturnError(sql.ErrNoRows)
+				}
+			}
+			if tt.expectTOTP {
+				result := sqlmock.NewResult(0, 1)
+				if tt.replayed {
+					result = sqlmock.NewResult(0, 0)
+				}
+				mock.ExpectExec("UPDATE users").
+					WithArgs(userID, sqlmock.AnyArg()).
+					WillReturnResult(result)
+			}
+			if tt.expectRecovery {
+				mock.ExpectExec("UPDATE recovery_codes").
+					WithArgs(userID, auth.HashToken("abcdefghijklmnop")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			if tt.expectedError == "" {
+				mock.ExpectExec("UPDATE login_challenges").
+					WithArgs(challengeHash).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("INSERT INTO refresh_tokens").
+					WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+						AddRow(mockRefreshTokenRow(userID, uuid.New(), "refresh-hash", "")...))
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/login/2fa", strings.NewReader(tt.requestBody))
+			w := httptest.NewRecorder()
+			err = srv.LoginTwoFactor(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+				var response loginResponse
+				if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if response.Token == "" || response.RefreshToken == "" || !response.TwoFactorEnabled {
+					t.Errorf("expected a session for a user with two-factor authentication, got %+v", response)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestConfirmTwoFactor(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("failed to generate TOTP secret: %v", err)
+	}
+	code, err := auth.GenerateTOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatalf("failed to generate TOTP code: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		enabled        int64
+		expectCodes    bool
+		codesErr       error
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "enabled with recovery codes",
+			enabled:        1,
+			expectCodes:    true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "concurrently enabled",
+			enabled:        0,
+			expectedStatus: http.StatusConflict,
+			expectedError:  "Two-factor authentication is already enabled",
+		},
+		{
+			name:           "failing recovery codes keep it disabled",
+			enabled:        1,
+			expectCodes:    true,
+			codesErr:       errors.New("connection reset"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "Internal Server Error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID := uuid.New()
+			userRow := mockUserRow(userID, "alice@example.com", "hash")
+			userRow[userTotpSecretColumn] = secret
+			mock.ExpectQuery("SELECT (.+) FROM users").
+				WithArgs(userID).
+				WillReturnRows(sqlmock.NewRows(userColumns).AddRow(userRow...))
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE users").
+				WithArgs(userID, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, tt.enabled))
+			if tt.expectCodes {
+				mock.ExpectExec("DELETE FROM recovery_codes").
+					WithArgs(userID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				insert := mock.ExpectExec("INSERT INTO recovery_codes").WithArgs(userID, sqlmock.AnyArg())
+				if tt.codesErr != nil {
+					insert.WillReturnError(tt.codesErr)
+				} else {
+					insert.WillReturnResult(sqlmock.NewResult(0, int64(recoveryCodeCount)))
+				}
+			}
+			if tt.expectedError == "" {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/users/me/2fa/confirm", strings.NewReader(`{"code": "`+code+`"}`))
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+			w := httptest.NewRecorder()
+			err = srv.ConfirmTwoFactor(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+				var response struct {
+					RecoveryCodes []string `json:"recovery_codes"`
+				}
+				if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if len(response.RecoveryCodes) != recoveryCodeCount {
+					t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(response.RecoveryCodes))
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	hashedPassword, err := auth.HashPassword("current")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		deleteErr      error
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "disabled",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "failing recovery code removal keeps it enabled",
+			deleteErr:      errors.New("connection reset"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "Internal Server Error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID := uuid.New()
+			userRow := mockUserRow(userID, "alice@example.com", hashedPassword)
+			userRow[userTotpSecretColumn], userRow[userTotpEnabledAtColumn] = "secret", time.Now()
+			mock.ExpectQuery("SELECT (.+) FROM users").
+				WithArgs(userID).
+				WillReturnRows(sqlmock.NewRows(userColumns).AddRow(userRow...))
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE users").
+				WithArgs(userID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			remove := mock.ExpectExec("DELETE FROM recovery_codes").WithArgs(userID)
+			if tt.deleteErr != nil {
+				remove.WillReturnError(tt.deleteErr)
+				mock.ExpectRollback()
+			} else {
+				remove.WillReturnResult(sqlmock.NewResult(0, int64(recoveryCodeCount)))
+				mock.ExpectCommit()
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/users/me/2fa", strings.NewReader(`{"current_password": "current"}`))
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+			w := httptest.NewRecorder()
+			err = srv.DisableTwoFactor(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/mail"
+	"regexp"
 	"strings"
 	"time"
 
@@ -12,17 +15,31 @@ import (
 	"github.com/szmktk/chirpy/internal/database"
 )
 
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+var reservedUsernames = map[string]bool{
+	"admin":  true,
+	"chirpy": true,
+}
+
 type User struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID               uuid.UUID `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	Email            string    `json:"email"`
+	Username         string    `json:"username,omitempty"`
+	DisplayName      string    `json:"display_name,omitempty"`
+	Bio              string    `json:"bio,omitempty"`
+	AvatarURL        string    `json:"avatar_url,omitempty"`
+	EmailVerified    bool      `json:"email_verified"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	IsChirpyRed      bool      `json:"is_chirpy_red"`
 }
 
 type UserData struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string  `json:"email"`
+	Password string  `json:"password"`
+	Username *string `json:"username"`
 }
 
 func (srv *Server) CreateUser(w http.ResponseWriter, r *http.Request) error {
@@ -43,11 +60,19 @@ func (srv *Server) CreateUser(w http.ResponseWriter, r *http.Request) error {
 		return APIError{Status: http.StatusBadRequest, Msg: "Email cannot be empty"}
 
 	}
+	if !isValidEmail(payload.Email) {
+		return APIError{Status: http.StatusBadRequest, Msg: "Email is not valid"}
+	}
 	if payload.Password == "" {
 		return APIError{Status: http.StatusBadRequest, Msg: "Password cannot be empty"}
 
 	}
 
+	username, err := parseUsername(payload.Username)
+	if err != nil {
+		return err
+	}
+
 	hashedPassword, err := auth.HashPassword(payload.Password)
 	if err != nil {
 		srv.logger.Error("Error hashing user password", "err", err)
@@ -58,10 +83,11 @@ func (srv *Server) CreateUser(w http.ResponseWriter, r *http.Request) error {
 	user, err := srv.db.CreateUser(r.Context(), database.CreateUserParams{
 		Email:          payload.Email,
 		HashedPassword: hashedPassword,
+		Username:       username,
 	})
 	if err != nil {
 		if isDuplicateKeyError(err) {
-			return APIError{Status: http.StatusConflict, Msg: "A user with this email already exists"}
+			return duplicateUserError(err)
 		} else {
 			srv.logger.Error("Error creating user", "err", err)
 			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
@@ -69,18 +95,62 @@ func (srv *Server) CreateUser(w http.ResponseWriter, r *http.Request) error {
 
 	}
 
+	if err := srv.sendVerificationEmail(r.Context(), user); err != nil {
+		srv.logger.Error("Error sending verification email", "user_id", user.ID, "err", err)
+	}
+
 	return respondWithJSON(w, http.StatusCreated, response{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User: mapDbUser(user),
 	})
 }
 
+func mapDbUser(u database.User) User {
+	return User{
+		ID:               u.ID,
+		CreatedAt:        u.CreatedAt,
+		UpdatedAt:        u.UpdatedAt,
+		Email:            u.Email,
+		Username:         u.Username.String,
+		DisplayName:      u.DisplayName.String,
+		Bio:              u.Bio.String,
+		AvatarURL:        u.AvatarUrl.String,
+		EmailVerified:    u.EmailVerifiedAt.Valid,
+		TwoFactorEnabled: u.TotpEnabledAt.Valid,
+		IsChirpyRed:      u.IsChirpyRed,
+	}
+}
+
+// isValidEmail reports whether s is a bare email address such as "user@example.com".
+func isValidEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+// parseUsername validates an optional username and normalizes it to lower case.
+// Usernames are 3 to 30 characters long and consist of letters, digits and underscores.
+func parseUsername(username *string) (sql.NullString, error) {
+	if username == nil {
+		return sql.NullString{}, nil
+	}
+	normalized := strings.ToLower(*username)
+	if !usernamePattern.MatchString(normalized) {
+		return sql.NullString{}, APIError{Status: http.StatusBadRequest, Msg: "Username must be 3 to 30 characters long and contain only letters, digits and underscores"}
+	}
+	if reservedUsernames[normalized] {
+		return sql.NullString{}, APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Username '%s' is reserved", normalized)}
+	}
+	return sql.NullString{String: normalized, Valid: true}, nil
+}
+
 // isDuplicateKeyError checks if the error is a result of a duplicate key constraint.
 func isDuplicateKeyError(err error) bool {
 	return strings.Contains(err.Error(), "duplicate key value")
 }
+
+// duplicateUserError reports which unique user attribute caused a duplicate key error.
+func duplicateUserError(err error) APIError {
+	if strings.Contains(err.Error(), "username") {
+		return APIError{Status: http.StatusConflict, Msg: "A user with this username already exists"}
+	}
+	return APIError{Status: http.StatusConflict, Msg: "A user with this email already exists"}
+}
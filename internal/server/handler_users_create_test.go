@@ -0,0 +1,72 @@
+package server
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// userColumns lists the columns of the users table in the order queries return them.
+var userColumns = []string{
+	"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red", "username", "display_name", "bio",
+	"avatar_url", "email_verified_at", "totp_secret", "totp_enabled_at", "totp_last_step",
+}
+
+// Indexes of optional columns in userColumns.
+const (
+	userEmailVerifiedAtColumn = 10
+	userTotpSecretColumn      = 11
+	userTotpEnabledAtColumn   = 12
+)
+
+// mockUserRow returns a users row with the given attributes. Optional columns are left NULL.
+func mockUserRow(id uuid.UUID, email, hashedPassword string) []driver.Value {
+	return []driver.Value{id, time.Now(), time.Now(), email, hashedPassword, false, nil, nil, nil, nil, nil, nil, nil, nil}
+}
+
+func TestParseUsername(t *testing.T) {
+	tests := []struct {
+		name          string
+		username      string
+		want          string
+		expectedError string
+	}{
+		{name: "valid", username: "alice_99", want: "alice_99"},
+		{name: "normalized to lower case", username: "Alice", want: "alice"},
+		{name: "too short", username: "al", expectedError: "Username must be 3 to 30 characters long and contain only letters, digits and underscores"},
+		{name: "invalid characters", username: "alice-bob", expectedError: "Username must be 3 to 30 characters long and contain only letters, digits and underscores"},
+		{name: "reserved", username: "Admin", expectedError: "Username 'admin' is reserved"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUsername(&tt.username)
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != http.StatusBadRequest {
+					t.Errorf("expected status %d, got %d", http.StatusBadRequest, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Valid || got.String != tt.want {
+				t.Errorf("expected username %q, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	if got, err := parseUsername(nil); err != nil || got.Valid {
+		t.Errorf("expected missing username to be accepted as null, got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxDisplayNameLength int = 50
+	maxBioLength         int = 160
+	maxAvatarURLLength   int = 2048
+)
+
+// UserProfile is the public view of a user. Unlike User, it never exposes the email address.
+type UserProfile struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Username       string    `json:"username"`
+	DisplayName    string    `json:"display_name,omitempty"`
+	Bio            string    `json:"bio,omitempty"`
+	AvatarURL      string    `json:"avatar_url,omitempty"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+}
+
+func (srv *Server) GetUserProfile(w http.ResponseWriter, r *http.Request) error {
+	username := strings.ToLower(r.PathValue("username"))
+
+	profile, err := srv.db.GetUserProfile(r.Context(), sql.NullString{String: username, Valid: true})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIError{Status: http.StatusNotFound, Msg: "User with given username has not been found"}
+		}
+		srv.logger.Error("Error getting user profile", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	return respondWithJSON(w, http.StatusOK, UserProfile{
+		ID:             profile.ID,
+		CreatedAt:      profile.CreatedAt,
+		Username:       profile.Username.String,
+		DisplayName:    profile.DisplayName.String,
+		Bio:            profile.Bio.String,
+		AvatarURL:      profile.AvatarUrl.String,
+		IsChirpyRed:    profile.IsChirpyRed,
+		FollowerCount:  profile.FollowerCount,
+		FollowingCount: profile.FollowingCount,
+	})
+}
+
+// parseProfileText validates an optional free-form profile field.
+// An empty string is passed through so that the field gets cleared.
+func parseProfileText(field string, value *string, maxLength int) (sql.NullString, error) {
+	if value == nil {
+		return sql.NullString{}, nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	if utf8.RuneCountInString(trimmed) > maxLength {
+		return sql.NullString{}, APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("%s cannot be longer than %d characters", field, maxLength)}
+	}
+	return sql.NullString{String: trimmed, Valid: true}, nil
+}
+
+// parseAvatarURL validates an optional avatar URL, which must be an absolute http(s) URL.
+// An empty string is passed through so that the avatar gets cleared.
+func parseAvatarURL(value *string) (sql.NullString, error) {
+	if value == nil {
+		return sql.NullString{}, nil
+	}
+	if *value == "" {
+		return sql.NullString{String: "", Valid: true}, nil
+	}
+	u, err := url.Parse(*value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(*value) > maxAvatarURLLength {
+		return sql.NullString{}, APIError{Status: http.StatusBadRequest, Msg: "Avatar URL must be a valid http or https URL"}
+	}
+	return sql.NullString{String: *value, Valid: true}, nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestGetUserProfile(t *testing.T) {
+	profileColumns := []string{"id", "created_at", "username", "display_name", "bio", "avatar_url", "is_chirpy_red", "follower_count", "following_count"}
+
+	tests := []struct {
+		name           string
+		username       string
+		found          bool
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "happy path",
+			username:       "Alice",
+			found:          true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown user",
+			username:       "nobody",
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "User with given username has not been found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			query := mock.ExpectQuery("FROM users").WithArgs(strings.ToLower(tt.username))
+			if tt.found {
+				query.WillReturnRows(sqlmock.NewRows(profileColumns).
+					AddRow(uuid.New(), time.Now(), "alice", "Alice", "Hello!", nil, false, 3, 1))
+			} else {
+				query.WillReturnError(sql.ErrNoRows)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/users/"+tt.username, nil)
+			req.SetPathValue("username", tt.username)
+			w := httptest.NewRecorder()
+			err = srv.GetUserProfile(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+				body := w.Body.String()
+				if strings.Contains(body, "email") {
+					t.Errorf("expected public profile not to expose the email, got %s", body)
+				}
+				if !strings.Contains(body, `"follower_count":3`) || strings.Contains(body, "avatar_url") {
+					t.Errorf("unexpected profile payload %s", body)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseAvatarURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "https", value: "https://example.com/me.png"},
+		{name: "empty clears the avatar", value: ""},
+		{name: "relative", value: "/me.png", wantErr: true},
+		{name: "unsupported scheme", value: "javascript:alert(1)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAvatarURL(&tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAvatarURL(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && (!got.Valid || got.String != tt.value) {
+				t.Errorf("parseAvatarURL(%q) = %+v", tt.value, got)
+			}
+		})
+	}
+}
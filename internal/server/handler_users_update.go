@@ -1,7 +1,9 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -9,7 +11,20 @@ import (
 	"github.com/szmktk/chirpy/internal/database"
 )
 
+// UpdateUser changes the attributes of the authenticated user.
+// Every field is optional: omitted fields are left unchanged and profile fields set to "" are cleared.
+// Changing the email or password requires the current password, and a password change
+// revokes every refresh token issued to the user.
 func (srv *Server) UpdateUser(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+		Username        *string `json:"username"`
+		DisplayName     *string `json:"display_name"`
+		Bio             *string `json:"bio"`
+		AvatarURL       *string `json:"avatar_url"`
+	}
 	type response struct {
 		User
 	}
@@ -21,36 +36,109 @@ func (srv *Server) UpdateUser(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	decoder := json.NewDecoder(r.Body)
-	payload := UserData{}
+	payload := input{}
 	err := decoder.Decode(&payload)
 	if err != nil {
 		srv.logger.Error("Error decoding JSON body", "err", err)
-		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
 	}
 
-	hashedPassword, err := auth.HashPassword(payload.Password)
-	if err != nil {
-		srv.logger.Error("Error hashing user password", "err", err)
-		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	params := database.UpdateUserParams{ID: parsedUserID}
+
+	var current database.User
+	if payload.Email != nil || payload.Password != nil {
+		if claims, ok := r.Context().Value(contextKeyClaims).(auth.Claims); ok && !claims.HasScopes(auth.ScopeAccountManage) {
+			return APIError{Status: http.StatusForbidden, Msg: "Token lacks the required scope"}
+		}
+		if payload.CurrentPassword == "" {
+			return APIError{Status: http.StatusBadRequest, Msg: "Current password is required to change email or password"}
+		}
+		current, err = srv.db.GetUserByID(r.Context(), parsedUserID)
+		if err != nil {
+			srv.logger.Error("Error getting user", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		if err := auth.CheckPasswordHash(payload.CurrentPassword, current.HashedPassword); err != nil {
+			srv.logger.Info("User provided password does not match the hash stored in the database", "err", err)
+			return APIError{Status: http.StatusUnauthorized, Msg: "Incorrect current password"}
+		}
+	}
+
+	if payload.Email != nil {
+		if *payload.Email == "" {
+			return APIError{Status: http.StatusBadRequest, Msg: "Email cannot be empty"}
+		}
+		if !isValidEmail(*payload.Email) {
+			return APIError{Status: http.StatusBadRequest, Msg: "Email is not valid"}
+		}
+		params.Email = sql.NullString{String: *payload.Email, Valid: true}
+	}
+
+	if payload.Password != nil {
+		if *payload.Password == "" {
+			return APIError{Status: http.StatusBadRequest, Msg: "Password cannot be empty"}
+		}
+		hashedPassword, err := auth.HashPassword(*payload.Password)
+		if err != nil {
+			srv.logger.Error("Error hashing user password", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		params.HashedPassword = sql.NullString{String: hashedPassword, Valid: true}
+	}
+
+	if params.Username, err = parseUsername(payload.Username); err != nil {
+		return err
+	}
+	if params.DisplayName, err = parseProfileText("Display name", payload.DisplayName, maxDisplayNameLength); err != nil {
+		return err
+	}
+	if params.Bio, err = parseProfileText("Bio", payload.Bio, maxBioLength); err != nil {
+		return err
 	}
+	if params.AvatarUrl, err = parseAvatarURL(payload.AvatarURL); err != nil {
+		return err
+	}
+
+	// Sessions are revoked in the same transaction as the password change, so a failing
+	// update neither signs the user out nor leaves the new password next to the old sessions.
+	var user database.User
+	err = srv.withTx(r.Context(), func(q *database.Queries) error {
+		if params.HashedPassword.Valid {
+			revoked, err := q.RevokeAllRefreshTokensForUser(r.Context(), parsedUserID)
+			if err != nil {
+				srv.logger.Error("Error revoking refresh tokens", "err", err)
+				return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+			}
+			srv.logger.Info("Revoking refresh tokens after password change", "user_id", parsedUserID, "count", revoked)
+		}
 
-	user, err := srv.db.UpdateUser(r.Context(), database.UpdateUserParams{
-		ID:             parsedUserID,
-		Email:          payload.Email,
-		HashedPassword: hashedPassword,
+		var err error
+		user, err = q.UpdateUser(r.Context(), params)
+		if err != nil {
+			if isDuplicateKeyError(err) {
+				return duplicateUserError(err)
+			}
+			srv.logger.Error("Error updating user data", "err", err)
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		return nil
 	})
-	if err != nil {
-		srv.logger.Error("Error updating user data", "err", err)
+	if _, ok := err.(APIError); err != nil && !ok {
+		srv.logger.Error("Error committing user update", "err", err)
 		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
+	if err != nil {
+		return err
+	}
+
+	// Changing the email resets its verification status, so the new address has to be verified again.
+	if params.Email.Valid && user.Email != current.Email {
+		if err := srv.sendVerificationEmail(r.Context(), user); err != nil {
+			srv.logger.Error("Error sending verification email", "user_id", user.ID, "err", err)
+		}
+	}
 
 	return respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User: mapDbUser(user),
 	})
 }
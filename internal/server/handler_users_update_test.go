@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestUpdateUser(t *testing.T) {
+	hashedPassword, err := auth.HashPassword("current")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		checkPassword  bool
+		expectRevoke   bool
+		expectUpdate   bool
+		updateErr      error
+		expectMail     bool
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "profile only",
+			requestBody:    `{"display_name": "Alice"}`,
+			expectUpdate:   true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "email without current password",
+			requestBody:    `{"email": "new@example.com"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Current password is required to change email or password",
+		},
+		{
+			name:           "wrong current password",
+			requestBody:    `{"email": "new@example.com", "current_password": "wrong"}`,
+			checkPassword:  true,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "Incorrect current password",
+		},
+		{
+			name:           "empty new password",
+			requestBody:    `{"password": "", "current_password": "current"}`,
+			checkPassword:  true,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Password cannot be empty",
+		},
+		{
+			name:           "invalid email",
+			requestBody:    `{"email": "Alice <new@example.com>", "current_password": "current"}`,
+			checkPassword:  true,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Email is not valid",
+		},
+		{
+			name:           "email change requires verification",
+			requestBody:    `{"email": "new@example.com", "current_password": "current"}`,
+			checkPassword:  true,
+			expectUpdate:   true,
+			expectMail:     true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "password change revokes sessions",
+			requestBody:    `{"password": "new", "current_password": "current"}`,
+			checkPassword:  true,
+			expectRevoke:   true,
+			expectUpdate:   true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "conflicting email keeps sessions",
+			requestBody:    `{"email": "taken@example.com", "password": "new", "current_password": "current"}`,
+			checkPassword:  true,
+			expectRevoke:   true,
+			expectUpdate:   true,
+			updateErr:      errors.New(`pq: duplicate key value violates unique constraint "users_email_key"`),
+			expectedStatus: http.StatusConflict,
+			expectedError:  "A user with this email already exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID := uuid.New()
+			userRow := mockUserRow(userID, "old@example.com", hashedPassword)
+			userRow[userEmailVerifiedAtColumn] = time.Now()
+			if tt.checkPassword {
+				mock.ExpectQuery("SELECT (.+) FROM users").
+					WithArgs(userID).
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(userRow...))
+			}
+			if tt.expectUpdate {
+				mock.ExpectBegin()
+			}
+			if tt.expectRevoke {
+				mock.ExpectExec("UPDATE refresh_tokens").
+					WithArgs(userID).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+			}
+			if tt.expectUpdate {
+				updatedRow := append([]driver.Value{}, userRow...)
+				if tt.expectMail {
+					updatedRow[3], updatedRow[userEmailVerifiedAtColumn] = "new@example.com", nil
+				}
+				if tt.updateErr != nil {
+					mock.ExpectQuery("UPDATE users").WillReturnError(tt.updateErr)
+					// the revoked sessions are restored by the rollback
+					mock.ExpectRollback()
+				} else {
+					mock.ExpectQuery("UPDATE users").
+						WillReturnRows(sqlmock.NewRows(userColumns).AddRow(updatedRow...))
+					mock.ExpectCommit()
+				}
+			}
+			if tt.expectMail {
+				mock.ExpectExec("UPDATE email_verification_tokens").
+					WithArgs(userID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("INSERT INTO email_verification_tokens").
+					WithArgs(sqlmock.AnyArg(), userID, "new@example.com", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mailer := &recordingMailer{}
+			srv.mailer = mailer
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/users/me", strings.NewReader(tt.requestBody))
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+			w := httptest.NewRecorder()
+			err = srv.UpdateUser(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+			}
+
+			if tt.expectMail != (len(mailer.sent) == 1) {
+				t.Errorf("expected verification email to be sent: %v, sent %d", tt.expectMail, len(mailer.sent))
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
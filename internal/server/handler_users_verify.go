@@ -0,0 +1,65 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+)
+
+func (srv *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	payload := input{}
+	if err := decoder.Decode(&payload); err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+	}
+	if payload.Token == "" {
+		return APIError{Status: http.StatusBadRequest, Msg: "Token cannot be empty"}
+	}
+
+	userID, err := srv.db.VerifyEmail(r.Context(), auth.HashToken(payload.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIError{Status: http.StatusBadRequest, Msg: "Verification token is invalid or has expired"}
+		}
+		srv.logger.Error("Error verifying email", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	srv.logger.Info("Email verified", "user_id", userID)
+	respondWithNoContent(w)
+	return nil
+}
+
+func (srv *Server) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	user, err := srv.db.GetUserByID(r.Context(), parsedUserID)
+	if err != nil {
+		srv.logger.Error("Error getting user", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if user.EmailVerifiedAt.Valid {
+		return APIError{Status: http.StatusConflict, Msg: "Email is already verified"}
+	}
+
+	if err := srv.sendVerificationEmail(r.Context(), user); err != nil {
+		srv.logger.Error("Error sending verification email", "user_id", user.ID, "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
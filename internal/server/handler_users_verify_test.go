@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/config"
+	"github.com/szmktk/chirpy/internal/mail"
+)
+
+// recordingMailer keeps sent emails in memory instead of delivering them.
+type recordingMailer struct {
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(_ context.Context, msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		valid          bool
+		expectQuery    bool
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "happy path",
+			requestBody:    `{"token": "secret"}`,
+			valid:          true,
+			expectQuery:    true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "invalid or expired token",
+			requestBody:    `{"token": "secret"}`,
+			expectQuery:    true,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Verification token is invalid or has expired",
+		},
+		{
+			name:           "missing token",
+			requestBody:    `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Token cannot be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			if tt.expectQuery {
+				// Only the hash of the token is ever sent to the database.
+				query := mock.ExpectQuery("UPDATE email_verification_tokens").WithArgs(auth.HashToken("secret"))
+				if tt.valid {
+					query.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+				} else {
+					query.WillReturnError(sql.ErrNoRows)
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/users/verify", strings.NewReader(tt.requestBody))
+			w := httptest.NewRecorder()
+			err = srv.VerifyEmail(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
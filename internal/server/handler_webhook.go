@@ -1,54 +1,228 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
 )
 
+const (
+	polkaProvider        = "polka"
+	polkaSignatureHeader = "Polka-Signature"
+	maxWebhookBodyBytes  = 64 << 10
+	// maxUnverifiedPayloadBytes is how much of a payload with an invalid signature is kept in the audit log,
+	// so unauthenticated senders cannot fill it up.
+	maxUnverifiedPayloadBytes = 1 << 10
+	// defaultSubscriptionPlan is the plan of subscriptions Polka does not name one for.
+	defaultSubscriptionPlan = "chirpy_red"
+)
+
+// Outcomes of received webhooks recorded in the audit log.
+const (
+	webhookOutcomeProcessed        = "processed"
+	webhookOutcomeIgnored          = "ignored"
+	webhookOutcomeDuplicate        = "duplicate"
+	webhookOutcomeInvalidSignature = "invalid_signature"
+	webhookOutcomeInvalidPayload   = "invalid_payload"
+	webhookOutcomeUserNotFound     = "user_not_found"
+	webhookOutcomeFailed           = "failed"
+)
+
+type polkaEvent struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserID uuid.UUID `json:"user_id"`
+		// Plan, PeriodStart and PeriodEnd describe the paid period of upgraded and renewed subscriptions.
+		Plan        string     `json:"plan"`
+		PeriodStart *time.Time `json:"period_start"`
+		PeriodEnd   *time.Time `json:"period_end"`
+	} `json:"data"`
+}
+
+// subscriptionUpdate is the data of subscription.updated events.
+type subscriptionUpdate struct {
+	// Event is the Polka event that changed the subscription, or subscription.expired when the paid period
+	// ended without a renewal.
+	Event            string    `json:"event"`
+	Plan             string    `json:"plan"`
+	Status           string    `json:"status"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+	IsChirpyRed      bool      `json:"is_chirpy_red"`
+}
+
+// UpgradeUserWebhook handles events sent by Polka. Payloads must be signed with the shared secret,
+// events are processed at most once by their ID and every received payload is written to the audit log.
 func (srv *Server) UpgradeUserWebhook(w http.ResponseWriter, r *http.Request) error {
-	type input struct {
-		Data struct {
-			UserID uuid.UUID `json:"user_id"`
-		} `json:"data"`
-		Event string `json:"event"`
+	audit := database.CreateWebhookAuditLogParams{Provider: polkaProvider}
+	outcome, err := srv.handlePolkaWebhook(w, r, &audit)
+
+	audit.Outcome = outcome
+	audit.StatusCode = http.StatusNoContent
+	if apiErr, ok := err.(APIError); ok {
+		audit.StatusCode = int32(apiErr.Status)
+	}
+	// the audit entry is written even if Polka has given up waiting for the response
+	if auditErr := srv.db.CreateWebhookAuditLog(context.WithoutCancel(r.Context()), audit); auditErr != nil {
+		srv.logger.Error("Error writing webhook audit log", "err", auditErr)
+	}
+	if err != nil {
+		return err
 	}
 
-	if apiKey, err := auth.GetApiKey(r.Header); err != nil || apiKey != srv.cfg.PolkaKey {
-		srv.logger.Debug("Error getting api key", "err", err)
-		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	respondWithNoContent(w)
+	return nil
+}
+
+func (srv *Server) handlePolkaWebhook(w http.ResponseWriter, r *http.Request, audit *database.CreateWebhookAuditLogParams) (string, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	// payloads are only kept in full once their signature has been verified
+	audit.Payload = truncateUTF8(string(body), maxUnverifiedPayloadBytes)
+	if err != nil {
+		srv.logger.Info("Error reading webhook body", "err", err)
+		return webhookOutcomeInvalidPayload, APIError{Status: http.StatusBadRequest, Msg: "Could not read request body"}
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
-	payload := input{}
-	err := decoder.Decode(&payload)
+	signature := r.Header.Get(polkaSignatureHeader)
+	err = auth.VerifyWebhookSignature([]byte(srv.cfg.PolkaWebhookSecret), signature, body, time.Now(), srv.cfg.PolkaWebhookTolerance)
 	if err != nil {
-		srv.logger.Error("Error decoding JSON body", "err", err)
-		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		srv.logger.Info("Rejected webhook signature", "provider", polkaProvider, "err", err)
+		return webhookOutcomeInvalidSignature, APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
 	}
-	srv.logger.Info("decoded payload", "json", payload)
+	audit.SignatureValid = true
+	audit.Payload = string(body)
 
-	if payload.Event != "user.upgraded" {
-		respondWithNoContent(w)
-		return nil
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	event := polkaEvent{}
+	if err := decoder.Decode(&event); err != nil {
+		srv.logger.Info("Error decoding webhook payload", "err", err)
+		return webhookOutcomeInvalidPayload, APIError{Status: http.StatusBadRequest, Msg: "Invalid webhook payload"}
+	}
+	audit.EventID = sql.NullString{String: event.ID, Valid: event.ID != ""}
+	audit.Event = sql.NullString{String: event.Event, Valid: event.Event != ""}
+	if event.ID == "" {
+		return webhookOutcomeInvalidPayload, APIError{Status: http.StatusBadRequest, Msg: "Event id is required"}
 	}
 
-	srv.logger.Info("handling webhook event", ".event", payload.Event)
-	_, err = srv.db.UpgradeUser(r.Context(), payload.Data.UserID)
-	if err != nil {
+	// the event is recorded in the same transaction as its effects, so it is processed again
+	// when Polka redelivers an event that failed
+	var outcome string
+	err = srv.withTx(r.Context(), func(q *database.Queries) error {
+		_, err := q.RecordWebhookEvent(r.Context(), database.RecordWebhookEventParams{
+			Provider: polkaProvider,
+			EventID:  event.ID,
+			Event:    event.Event,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				srv.logger.Info("Acknowledging redelivered webhook event", "event_id", event.ID, "event", event.Event)
+				outcome = webhookOutcomeDuplicate
+				return nil
+			}
+			srv.logger.Error("Error recording webhook event", "err", err)
+			outcome = webhookOutcomeFailed
+			return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+
+		outcome, err = srv.processPolkaEvent(r.Context(), q, event)
+		return err
+	})
+	if _, ok := err.(APIError); err != nil && !ok {
+		srv.logger.Error("Error committing webhook event", "err", err)
+		return webhookOutcomeFailed, APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	return outcome, err
+}
+
+// processPolkaEvent applies a subscription event and derives the Chirpy Red flag of the user from the result.
+// Upgrades and renewals start a new paid period, cancellations and failed payments keep the subscription
+// until the end of the paid period, and downgrades end it right away. Changes are recorded as a
+// subscription.updated event.
+func (srv *Server) processPolkaEvent(ctx context.Context, q *database.Queries, event polkaEvent) (string, error) {
+	userID := event.Data.UserID
+	var subscription database.Subscription
+	var err error
+	switch event.Event {
+	case "user.upgraded", "user.renewed":
+		params, validationErr := subscriptionPeriod(event)
+		if validationErr != nil {
+			return webhookOutcomeInvalidPayload, validationErr
+		}
+		subscription, err = q.UpsertSubscription(ctx, params)
 		if errors.Is(err, sql.ErrNoRows) {
-			srv.logger.Info("User not found", "user_id", payload.Data.UserID)
-			return APIError{Status: http.StatusNotFound, Msg: "User with given id has not been found"}
+			srv.logger.Info("User not found", "user_id", userID)
+			return webhookOutcomeUserNotFound, APIError{Status: http.StatusNotFound, Msg: "User with given id has not been found"}
 		}
-		srv.logger.Error("Error upgrading user", "err", err)
-		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	case "user.canceled":
+		subscription, err = q.CancelSubscription(ctx, userID)
+	case "user.payment_failed":
+		subscription, err = q.MarkSubscriptionPastDue(ctx, userID)
+	case "user.downgraded":
+		subscription, err = q.EndSubscription(ctx, userID)
+	default:
+		return webhookOutcomeIgnored, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		srv.logger.Info("No subscription to update", "user_id", userID, "event", event.Event)
+		return webhookOutcomeIgnored, nil
+	}
+	if err != nil {
+		srv.logger.Error("Error updating subscription", "event", event.Event, "err", err)
+		return webhookOutcomeFailed, APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
 	}
 
-	respondWithNoContent(w)
-	return nil
+	srv.logger.Info("handled webhook event", "event_id", event.ID, "event", event.Event, "user_id", userID)
+	isChirpyRed, err := q.SyncChirpyRed(ctx, userID)
+	if err != nil {
+		srv.logger.Error("Error updating Chirpy Red status", "user_id", userID, "err", err)
+		return webhookOutcomeFailed, APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	err = events.Record(ctx, q, events.SubscriptionUpdated, userID, subscriptionUpdate{
+		Event:            event.Event,
+		Plan:             subscription.Plan,
+		Status:           subscription.Status,
+		CurrentPeriodEnd: subscription.CurrentPeriodEnd,
+		IsChirpyRed:      isChirpyRed,
+	})
+	if err != nil {
+		srv.logger.Error("Error recording subscription event", "user_id", userID, "err", err)
+		return webhookOutcomeFailed, APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	return webhookOutcomeProcessed, nil
+}
+
+// subscriptionPeriod returns the paid period of an upgrade or renewal,
+// which lasts a month from now unless the event says otherwise.
+func subscriptionPeriod(event polkaEvent) (database.UpsertSubscriptionParams, error) {
+	params := database.UpsertSubscriptionParams{
+		UserID:             event.Data.UserID,
+		Plan:               event.Data.Plan,
+		CurrentPeriodStart: time.Now().UTC(),
+	}
+	if params.Plan == "" {
+		params.Plan = defaultSubscriptionPlan
+	}
+	if event.Data.PeriodStart != nil {
+		params.CurrentPeriodStart = event.Data.PeriodStart.UTC()
+	}
+	params.CurrentPeriodEnd = params.CurrentPeriodStart.AddDate(0, 1, 0)
+	if event.Data.PeriodEnd != nil {
+		params.CurrentPeriodEnd = event.Data.PeriodEnd.UTC()
+	}
+	if !params.CurrentPeriodEnd.After(params.CurrentPeriodStart) {
+		return params, APIError{Status: http.StatusBadRequest, Msg: "Subscription period must end after it starts"}
+	}
+	return params, nil
 }
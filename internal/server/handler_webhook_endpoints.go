@@ -0,0 +1,359 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/webhooks"
+)
+
+const (
+	maxWebhookEndpoints int64  = 10
+	maxWebhookURLLength int    = 2048
+	webhookSecretPrefix string = "whsec_"
+)
+
+// WebhookEndpoint describes an endpoint receiving outgoing webhooks. The signing secret is only
+// returned once, when the endpoint is created.
+type WebhookEndpoint struct {
+	ID         uuid.UUID `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+	Secret     string    `json:"secret,omitempty"`
+}
+
+// WebhookDelivery describes a delivery of an event to an endpoint. Attempts are only listed
+// when a single delivery is requested.
+type WebhookDelivery struct {
+	ID            uuid.UUID                `json:"id"`
+	EventID       uuid.UUID                `json:"event_id"`
+	EventType     string                   `json:"event_type"`
+	Payload       json.RawMessage          `json:"payload"`
+	Status        string                   `json:"status"`
+	Attempts      int32                    `json:"attempts"`
+	NextAttemptAt *time.Time               `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time                `json:"created_at"`
+	DeliveredAt   *time.Time               `json:"delivered_at,omitempty"`
+	AttemptLog    []WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+// WebhookDeliveryAttempt describes a single attempt to send a delivery.
+type WebhookDeliveryAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  int32     `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int32     `json:"duration_ms"`
+}
+
+type WebhookDeliveryPage struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// CreateWebhookEndpoint registers an endpoint receiving the given event types of the user's account.
+func (srv *Server) CreateWebhookEndpoint(w http.ResponseWriter, r *http.Request) error {
+	type input struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+	}
+
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	payload := input{}
+	err := decoder.Decode(&payload)
+	if err != nil {
+		srv.logger.Error("Error decoding JSON body", "err", err)
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error decoding JSON body: %s", err)}
+	}
+
+	endpointURL := strings.TrimSpace(payload.URL)
+	if err := validateWebhookURL(endpointURL); err != nil {
+		return err
+	}
+	if len(payload.EventTypes) == 0 {
+		return APIError{Status: http.StatusBadRequest, Msg: "At least one event type is required"}
+	}
+	var eventTypes []string
+	for _, eventType := range payload.EventTypes {
+		if !webhooks.IsValidEventType(eventType) {
+			return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Unknown event type %q, expected one of: %s", eventType, strings.Join(webhooks.EventTypes, ", "))}
+		}
+		if !slices.Contains(eventTypes, eventType) {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+
+	count, err := srv.db.CountWebhookEndpoints(r.Context(), parsedUserID)
+	if err != nil {
+		srv.logger.Error("Error counting webhook endpoints", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if count >= maxWebhookEndpoints {
+		return APIError{Status: http.StatusConflict, Msg: fmt.Sprintf("Cannot have more than %d webhook endpoints, delete unused ones first", maxWebhookEndpoints)}
+	}
+
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		srv.logger.Error("Error generating webhook secret", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	endpoint, err := srv.db.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID:     parsedUserID,
+		Url:        endpointURL,
+		Secret:     webhookSecretPrefix + token,
+		EventTypes: eventTypes,
+	})
+	if err != nil {
+		srv.logger.Error("Error creating webhook endpoint", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	srv.logger.Info("Created webhook endpoint", "user_id", parsedUserID, "endpoint_id", endpoint.ID, "event_types", endpoint.EventTypes)
+	created := mapDbWebhookEndpoint(endpoint)
+	created.Secret = endpoint.Secret
+	return respondWithJSON(w, http.StatusCreated, created)
+}
+
+func (srv *Server) GetWebhookEndpoints(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	dbEndpoints, err := srv.db.ListWebhookEndpoints(r.Context(), parsedUserID)
+	if err != nil {
+		srv.logger.Error("Error listing webhook endpoints", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	endpoints := make([]WebhookEndpoint, 0, len(dbEndpoints))
+	for _, dbEndpoint := range dbEndpoints {
+		endpoints = append(endpoints, mapDbWebhookEndpoint(dbEndpoint))
+	}
+	return respondWithJSON(w, http.StatusOK, endpoints)
+}
+
+// DeleteWebhookEndpoint removes an endpoint together with its deliveries.
+func (srv *Server) DeleteWebhookEndpoint(w http.ResponseWriter, r *http.Request) error {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	endpointID, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	deleted, err := srv.db.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: parsedUserID,
+	})
+	if err != nil {
+		srv.logger.Error("Error deleting webhook endpoint", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	if deleted == 0 {
+		return APIError{Status: http.StatusNotFound, Msg: "Webhook endpoint with given id has not been found"}
+	}
+
+	respondWithNoContent(w)
+	return nil
+}
+
+// GetWebhookDeliveries lists the deliveries of an endpoint, most recent first.
+func (srv *Server) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) error {
+	endpoint, err := srv.ownWebhookEndpoint(r)
+	if err != nil {
+		return err
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		return err
+	}
+	cursorCreatedAt, cursorID := page.cursorArgs()
+
+	rows, err := srv.db.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+		EndpointID:      endpoint.ID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        page.rowLimit(),
+	})
+	if err != nil {
+		srv.logger.Error("Error listing webhook deliveries", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	rows, nextCursor := paginate(rows, page, func(row database.WebhookDelivery) pageCursor {
+		return pageCursor{CreatedAt: row.CreatedAt, ID: row.ID}
+	})
+	deliveries := make([]WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		deliveries = append(deliveries, mapDbWebhookDelivery(row))
+	}
+
+	return respondWithJSON(w, http.StatusOK, WebhookDeliveryPage{Deliveries: deliveries, NextCursor: nextCursor})
+}
+
+// GetWebhookDelivery returns a delivery of an endpoint together with every attempt to send it.
+func (srv *Server) GetWebhookDelivery(w http.ResponseWriter, r *http.Request) error {
+	endpoint, err := srv.ownWebhookEndpoint(r)
+	if err != nil {
+		return err
+	}
+
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	dbDelivery, err := srv.db.GetWebhookDelivery(r.Context(), database.GetWebhookDeliveryParams{
+		ID:         deliveryID,
+		EndpointID: endpoint.ID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIError{Status: http.StatusNotFound, Msg: "Webhook delivery with given id has not been found"}
+		}
+		srv.logger.Error("Error getting webhook delivery", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	dbAttempts, err := srv.db.ListWebhookDeliveryAttempts(r.Context(), dbDelivery.ID)
+	if err != nil {
+		srv.logger.Error("Error listing webhook delivery attempts", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	delivery := mapDbWebhookDelivery(dbDelivery)
+	delivery.AttemptLog = make([]WebhookDeliveryAttempt, 0, len(dbAttempts))
+	for _, dbAttempt := range dbAttempts {
+		delivery.AttemptLog = append(delivery.AttemptLog, WebhookDeliveryAttempt{
+			AttemptedAt: dbAttempt.AttemptedAt,
+			StatusCode:  dbAttempt.StatusCode.Int32,
+			Error:       dbAttempt.Error.String,
+			DurationMs:  dbAttempt.DurationMs,
+		})
+	}
+	return respondWithJSON(w, http.StatusOK, delivery)
+}
+
+// RedeliverWebhookDelivery queues the payload of a past delivery again, as a new delivery with the same event id.
+func (srv *Server) RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) error {
+	endpoint, err := srv.ownWebhookEndpoint(r)
+	if err != nil {
+		return err
+	}
+
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	dbDelivery, err := srv.db.RedeliverWebhookDelivery(r.Context(), database.RedeliverWebhookDeliveryParams{
+		ID:         deliveryID,
+		EndpointID: endpoint.ID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIError{Status: http.StatusNotFound, Msg: "Webhook delivery with given id has not been found"}
+		}
+		srv.logger.Error("Error redelivering webhook delivery", "err", err)
+		return APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+
+	srv.logger.Info("Queued webhook redelivery", "endpoint_id", endpoint.ID, "delivery_id", deliveryID, "redelivery_id", dbDelivery.ID)
+	return respondWithJSON(w, http.StatusAccepted, mapDbWebhookDelivery(dbDelivery))
+}
+
+// ownWebhookEndpoint returns the endpoint identified by the webhookID path value,
+// or a 404 APIError unless it belongs to the authenticated user.
+func (srv *Server) ownWebhookEndpoint(r *http.Request) (database.WebhookEndpoint, error) {
+	ctxVal := r.Context().Value(contextKeyUserID)
+	parsedUserID, ok := ctxVal.(uuid.UUID)
+	if !ok {
+		return database.WebhookEndpoint{}, APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+
+	endpointID, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		return database.WebhookEndpoint{}, APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Error parsing UUID: %s", err)}
+	}
+
+	endpoint, err := srv.db.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: parsedUserID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.WebhookEndpoint{}, APIError{Status: http.StatusNotFound, Msg: "Webhook endpoint with given id has not been found"}
+		}
+		srv.logger.Error("Error getting webhook endpoint", "err", err)
+		return database.WebhookEndpoint{}, APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+	}
+	return endpoint, nil
+}
+
+// validateWebhookURL accepts absolute http(s) URLs. Whether the host is reachable, and public,
+// is checked by the worker when deliveries are sent.
+func validateWebhookURL(rawURL string) error {
+	if rawURL == "" {
+		return APIError{Status: http.StatusBadRequest, Msg: "URL cannot be empty"}
+	}
+	if len(rawURL) > maxWebhookURLLength {
+		return APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("URL cannot be longer than %d characters", maxWebhookURLLength)}
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.User != nil {
+		return APIError{Status: http.StatusBadRequest, Msg: "URL must be an absolute http or https URL"}
+	}
+	return nil
+}
+
+func mapDbWebhookEndpoint(dbEndpoint database.WebhookEndpoint) WebhookEndpoint {
+	return WebhookEndpoint{
+		ID:         dbEndpoint.ID,
+		URL:        dbEndpoint.Url,
+		EventTypes: dbEndpoint.EventTypes,
+		CreatedAt:  dbEndpoint.CreatedAt,
+	}
+}
+
+func mapDbWebhookDelivery(dbDelivery database.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:        dbDelivery.ID,
+		EventID:   dbDelivery.EventID,
+		EventType: dbDelivery.EventType,
+		Payload:   json.RawMessage(dbDelivery.Payload),
+		Status:    dbDelivery.Status,
+		Attempts:  dbDelivery.Attempts,
+		CreatedAt: dbDelivery.CreatedAt,
+	}
+	if dbDelivery.Status == "pending" {
+		delivery.NextAttemptAt = &dbDelivery.NextAttemptAt
+	}
+	if dbDelivery.DeliveredAt.Valid {
+		delivery.DeliveredAt = &dbDelivery.DeliveredAt.Time
+	}
+	return delivery
+}
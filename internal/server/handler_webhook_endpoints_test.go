@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+var (
+	webhookEndpointColumns = []string{"id", "user_id", "url", "secret", "event_types", "created_at"}
+	webhookDeliveryColumns = []string{"id", "endpoint_id", "event_id", "event_type", "payload", "status", "attempts", "next_attempt_at", "created_at", "delivered_at"}
+)
+
+func TestCreateWebhookEndpoint(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		endpoints      int64
+		expectCount    bool
+		expectInsert   bool
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "happy path",
+			body:           `{"url": "https://example.com/hooks", "event_types": ["chirp.created", "user.followed", "chirp.created"]}`,
+			expectCount:    true,
+			expectInsert:   true,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "relative url",
+			body:           `{"url": "/hooks", "event_types": ["chirp.created"]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "URL must be an absolute http or https URL",
+		},
+		{
+			name:           "unsupported scheme",
+			body:           `{"url": "ftp://example.com/hooks", "event_types": ["chirp.created"]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "URL must be an absolute http or https URL",
+		},
+		{
+			name:           "no event types",
+			body:           `{"url": "https://example.com/hooks"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "At least one event type is required",
+		},
+		{
+			name:           "unknown event type",
+			body:           `{"url": "https://example.com/hooks", "event_types": ["chirp.edited"]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `Unknown event type "chirp.edited", expected one of: chirp.created, chirp.deleted, chirp.liked, user.followed`,
+		},
+		{
+			name:           "too many endpoints",
+			body:           `{"url": "https://example.com/hooks", "event_types": ["chirp.created"]}`,
+			endpoints:      10,
+			expectCount:    true,
+			expectedStatus: http.StatusConflict,
+			expectedError:  "Cannot have more than 10 webhook endpoints, delete unused ones first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID := uuid.New()
+			if tt.expectCount {
+				mock.ExpectQuery("SELECT COUNT").
+					WithArgs(userID).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.endpoints))
+			}
+			if tt.expectInsert {
+				mock.ExpectQuery("INSERT INTO webhook_endpoints").
+					WithArgs(userID, "https://example.com/hooks", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(webhookEndpointColumns).
+						AddRow(uuid.New(), userID, "https://example.com/hooks", "whsec_secret", "{chirp.created,user.followed}", time.Now()))
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+			w := httptest.NewRecorder()
+			err = srv.CreateWebhookEndpoint(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+				var created WebhookEndpoint
+				if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if created.Secret != "whsec_secret" {
+					t.Errorf("expected the signing secret to be returned, got %q", created.Secret)
+				}
+				if len(created.EventTypes) != 2 {
+					t.Errorf("unexpected endpoint %+v", created)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetWebhookDelivery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	userID, endpointID, deliveryID := uuid.New(), uuid.New(), uuid.New()
+	now := time.Now().UTC()
+	mock.ExpectQuery("SELECT (.+) FROM webhook_endpoints").
+		WithArgs(endpointID, userID).
+		WillReturnRows(sqlmock.NewRows(webhookEndpointColumns).
+			AddRow(endpointID, userID, "https://example.com/hooks", "whsec_secret", "{chirp.created}", now))
+	mock.ExpectQuery("SELECT (.+) FROM webhook_deliveries").
+		WithArgs(deliveryID, endpointID).
+		WillReturnRows(sqlmock.NewRows(webhookDeliveryColumns).
+			AddRow(deliveryID, endpointID, uuid.New(), "chirp.created", `{"type":"chirp.created"}`, "succeeded", 2, now, now, now))
+	mock.ExpectQuery("SELECT (.+) FROM webhook_delivery_attempts").
+		WithArgs(deliveryID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "delivery_id", "attempted_at", "status_code", "error", "duration_ms"}).
+			AddRow(uuid.New(), deliveryID, now, 200, nil, 35).
+			AddRow(uuid.New(), deliveryID, now.Add(-time.Minute), 503, "unexpected response status 503", 120))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/webhooks/"+endpointID.String()+"/deliveries/"+deliveryID.String(), nil)
+	req.SetPathValue("webhookID", endpointID.String())
+	req.SetPathValue("deliveryID", deliveryID.String())
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+	w := httptest.NewRecorder()
+	if err := srv.GetWebhookDelivery(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var delivery WebhookDelivery
+	if err := json.NewDecoder(w.Body).Decode(&delivery); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if delivery.Status != "succeeded" || delivery.DeliveredAt == nil || delivery.NextAttemptAt != nil {
+		t.Errorf("unexpected delivery %+v", delivery)
+	}
+	if string(delivery.Payload) != `{"type":"chirp.created"}` {
+		t.Errorf("expected the payload to be embedded, got %s", delivery.Payload)
+	}
+	if len(delivery.AttemptLog) != 2 || delivery.AttemptLog[0].StatusCode != 200 || delivery.AttemptLog[1].Error == "" {
+		t.Errorf("unexpected attempts %+v", delivery.AttemptLog)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestRedeliverWebhookDelivery(t *testing.T) {
+	tests := []struct {
+		name            string
+		endpointFound   bool
+		deliveryFound   bool
+		expectRedeliver bool
+		expectedStatus  int
+		expectedError   string
+	}{
+		{
+			name:            "happy path",
+			endpointFound:   true,
+			deliveryFound:   true,
+			expectRedeliver: true,
+			expectedStatus:  http.StatusAccepted,
+		},
+		{
+			name:           "endpoint of another user",
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "Webhook endpoint with given id has not been found",
+		},
+		{
+			name:            "unknown delivery",
+			endpointFound:   true,
+			expectRedeliver: true,
+			expectedStatus:  http.StatusNotFound,
+			expectedError:   "Webhook delivery with given id has not been found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			userID, endpointID, deliveryID := uuid.New(), uuid.New(), uuid.New()
+			now := time.Now().UTC()
+			endpointQuery := mock.ExpectQuery("SELECT (.+) FROM webhook_endpoints").WithArgs(endpointID, userID)
+			if tt.endpointFound {
+				endpointQuery.WillReturnRows(sqlmock.NewRows(webhookEndpointColumns).
+					AddRow(endpointID, userID, "https://example.com/hooks", "whsec_secret", "{chirp.created}", now))
+			} else {
+				endpointQuery.WillReturnError(sql.ErrNoRows)
+			}
+			if tt.expectRedeliver {
+				rows := sqlmock.NewRows(webhookDeliveryColumns)
+				if tt.deliveryFound {
+					rows.AddRow(uuid.New(), endpointID, uuid.New(), "chirp.created", `{}`, "pending", 0, now, now, nil)
+				}
+				mock.ExpectQuery("INSERT INTO webhook_deliveries").
+					WithArgs(deliveryID, endpointID).
+					WillReturnRows(rows)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/webhooks/"+endpointID.String()+"/deliveries/"+deliveryID.String()+"/redeliver", nil)
+			req.SetPathValue("webhookID", endpointID.String())
+			req.SetPathValue("deliveryID", deliveryID.String())
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+			w := httptest.NewRecorder()
+			err = srv.RedeliverWebhookDelivery(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+				var delivery WebhookDelivery
+				if err := json.NewDecoder(w.Body).Decode(&delivery); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if delivery.ID == deliveryID || delivery.Status != "pending" || delivery.NextAttemptAt == nil {
+					t.Errorf("expected a new pending delivery, got %+v", delivery)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestUpgradeUserWebhook(t *testing.T) {
+	const secret = "polka-secret"
+	userID := uuid.New()
+	upgraded := `{"id": "evt_1", "event": "user.upgraded", "data": {"user_id": "` + userID.String() + `"}}`
+
+	subscriptionRow := func(status string) *sqlmock.Rows {
+		row := mockSubscriptionRow(userID, "chirpy_red")
+		row[3] = status
+		return sqlmock.NewRows(subscriptionColumns).AddRow(row...)
+	}
+	// expectSync expects the Chirpy Red flag to be derived and the change to be recorded in the outbox
+	expectSync := func(mock sqlmock.Sqlmock, isChirpyRed bool) {
+		mock.ExpectQuery("UPDATE users").
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"is_chirpy_red"}).AddRow(isChirpyRed))
+		mock.ExpectExec("INSERT INTO outbox").
+			WithArgs(sqlmock.AnyArg(), "subscription.updated", userID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	event := func(name, data string) string {
+		return `{"id": "evt_1", "event": "` + name + `", "data": {"user_id": "` + userID.String() + `"` + data + `}}`
+	}
+	periodStart := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		body            string
+		signature       func(body string) string
+		expectRecord    bool
+		duplicate       bool
+		setup           func(mock sqlmock.Sqlmock)
+		expectedStatus  int
+		expectedError   string
+		expectedOutcome string
+		// auditPayload is the payload expected in the audit log, the body unless set
+		auditPayload string
+	}{
+		{
+			name:         "upgrades the user",
+			body:         upgraded,
+			expectRecord: true,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO subscriptions").
+					WithArgs(userID, "chirpy_red", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(subscriptionRow("active"))
+				expectSync(mock, true)
+			},
+			expectedStatus:  http.StatusNoContent,
+			expectedOutcome: "processed",
+		},
+		{
+			name:         "renewal with a paid period",
+			body:         event("user.renewed", `, "plan": "chirpy_red_yearly", "period_start": "2025-01-01T00:00:00Z", "period_end": "2026-01-01T00:00:00Z"`),
+			expectRecord: true,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO subscriptions").
+					WithArgs(userID, "chirpy_red_yearly", periodStart, periodStart.AddDate(1, 0, 0)).
+					WillReturnRows(subscriptionRow("active"))
+				expectSync(mock, true)
+			},
+			expectedStatus:  http.StatusNoContent,
+			expectedOutcome: "processed",
+		},
+		{
+			name:            "invalid paid period",
+			body:            event("user.renewed", `, "period_start": "2025-01-01T00:00:00Z", "period_end": "2024-01-01T00:00:00Z"`),
+			expectRecord:    true,
+			expectedStatus:  http.StatusBadRequest,
+			expectedError:   "Subscription period must end after it starts",
+			expectedOutcome: "invalid_payload",
+		},
+		{
+			name:         "cancellation",
+			body:         event("user.canceled", ""),
+			expectRecord: true,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("UPDATE subscriptions SET status = 'canceled'").
+					WithArgs(userID).
+					WillReturnRows(subscriptionRow("canceled"))
+				expectSync(mock, true)
+			},
+			expectedStatus:  http.StatusNoContent,
+			expectedOutcome: "processed",
+		},
+		{
+			name:         "failed payment",
+			body:         event("user.payment_failed", ""),
+			expectRecord: true,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("UPDATE subscriptions SET status = 'past_due'").
+					WithArgs(userID).
+					WillReturnRows(subscriptionRow("past_due"))
+				expectSync(mock, true)
+			},
+			expectedStatus:  http.StatusNoContent,
+			expectedOutcome: "processed",
+		},
+		{
+			name:         "downgrade",
+			body:         event("user.downgraded", ""),
+			expectRecord: true,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("UPDATE subscriptions SET status = 'expired'").
+					WithArgs(userID).
+					WillReturnRows(subscriptionRow("expired"))
+				expectSync(mock, false)
+			},
+			expectedStatus:  http.StatusNoContent,
+			expectedOutcome: "processed",
+		},
+		{
+			name:         "downgrade without a subscription",
+			body:         event("user.downgraded", ""),
+			expectRecord: true,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("UPDATE subscriptions SET status = 'expired'").
+					WithArgs(userID).
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectedStatus:  http.StatusNoContent,
+			expectedOutcome: "ignored",
+		},
+		{
+			name:            "redelivered event",
+			body:            upgraded,
+			expectRecord:    true,
+			duplicate:       true,
+			expectedStatus:  http.StatusNoContent,
+			expectedOutcome: "duplicate",
+		},
+		{
+			name:            "other event",
+			body:            event("user.created", ""),
+			expectRecord:    true,
+			expectedStatus:  http.StatusNoContent,
+			expectedOutcome: "ignored",
+		},
+		{
+			name:         "unknown user",
+			body:         upgraded,
+			expectRecord: true,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO subscriptions").
+					WithArgs(userID, "chirpy_red", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectedStatus:  http.StatusNotFound,
+			expectedError:   "User with given id has not been found",
+			expectedOutcome: "user_not_found",
+		},
+		{
+			name:            "wrong secret",
+			body:            upgraded,
+			signature:       func(body string) string { return auth.SignWebhook([]byte("other"), time.Now(), []byte(body)) },
+			expectedStatus:  http.StatusUnauthorized,
+			expectedError:   "Unauthorized",
+			expectedOutcome: "invalid_signature",
+		},
+		{
+			name:            "unsigned payloads are truncated in the audit log",
+			body:            strings.Repeat("x", maxUnverifiedPayloadBytes+100),
+			signature:       func(string) string { return "" },
+			expectedStatus:  http.StatusUnauthorized,
+			expectedError:   "Unauthorized",
+			expectedOutcome: "invalid_signature",
+			auditPayload:    strings.Repeat("x", maxUnverifiedPayloadBytes),
+		},
+		{
+			name: "replayed",
+			body: upgraded,
+			signature: func(body string) string {
+				return auth.SignWebhook([]byte(secret), time.Now().Add(-time.Hour), []byte(body))
+			},
+			expectedStatus:  http.StatusUnauthorized,
+			expectedError:   "Unauthorized",
+			expectedOutcome: "invalid_signature",
+		},
+		{
+			name:            "legacy api key",
+			body:            upgraded,
+			signature:       func(string) string { return "" },
+			expectedStatus:  http.StatusUnauthorized,
+			expectedError:   "Unauthorized",
+			expectedOutcome: "invalid_signature",
+		},
+		{
+			name:            "missing event id",
+			body:            `{"event": "user.upgraded", "data": {"user_id": "` + userID.String() + `"}}`,
+			expectedStatus:  http.StatusBadRequest,
+			expectedError:   "Event id is required",
+			expectedOutcome: "invalid_payload",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			cfg := &config.Config{PolkaWebhookSecret: secret, PolkaWebhookTolerance: 5 * time.Minute}
+			srv, err := NewServer(cfg, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			if tt.expectRecord {
+				rows := sqlmock.NewRows([]string{"event_id"})
+				if !tt.duplicate {
+					rows.AddRow("evt_1")
+				}
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO webhook_events").
+					WithArgs("polka", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(rows)
+			}
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+			if tt.expectRecord {
+				// failed events are rolled back, so they are processed again when redelivered
+				if tt.expectedError != "" {
+					mock.ExpectRollback()
+				} else {
+					mock.ExpectCommit()
+				}
+			}
+			auditPayload := tt.body
+			if tt.auditPayload != "" {
+				auditPayload = tt.auditPayload
+			}
+			mock.ExpectExec("INSERT INTO webhook_audit_log").
+				WithArgs("polka", sqlmock.AnyArg(), sqlmock.AnyArg(), auditPayload, tt.expectedOutcome != "invalid_signature", tt.expectedOutcome, tt.expectedStatus).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			signature := auth.SignWebhook([]byte(secret), time.Now(), []byte(tt.body))
+			if tt.signature != nil {
+				signature = tt.signature(tt.body)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/polka/webhooks", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "ApiKey "+secret)
+			if signature != "" {
+				req.Header.Set("Polka-Signature", signature)
+			}
+			w := httptest.NewRecorder()
+			err = srv.UpgradeUserWebhook(w, req)
+
+			if tt.expectedError != "" {
+				apiErr, ok := err.(APIError)
+				if !ok {
+					t.Fatalf("expected APIError, got %T", err)
+				}
+				if apiErr.Status != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, apiErr.Status)
+				}
+				if apiErr.Msg != tt.expectedError {
+					t.Errorf("expected error message %q, got %q", tt.expectedError, apiErr.Msg)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.Code != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
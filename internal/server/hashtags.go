@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+const maxHashtagLength int = 100
+
+// extractHashtags returns the normalized, de-duplicated #tags found in a chirp body.
+// It expects the sanitized body and additionally skips tags spelling out a forbidden word,
+// since sanitizeInput only masks words without the leading `#`.
+func extractHashtags(body string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, word := range strings.Fields(body) {
+		if !strings.HasPrefix(word, "#") {
+			continue
+		}
+		tag := strings.TrimPrefix(word, "#")
+		if end := strings.IndexFunc(tag, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+		}); end >= 0 {
+			tag = tag[:end]
+		}
+		tag = strings.ToLower(tag)
+		if tag == "" || len(tag) > maxHashtagLength || forbiddenWords[tag] || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// hashtagSink links chirps to their hashtags on chirp.created and chirp.updated events.
+// Chirps are tagged from their current body, so publishing an event again, or out of order,
+// leaves the same tags behind.
+type hashtagSink struct {
+	srv *Server
+}
+
+// HashtagSink returns the events.Sink tagging chirps.
+func (srv *Server) HashtagSink() events.Sink {
+	return &hashtagSink{srv: srv}
+}
+
+func (s *hashtagSink) Name() string {
+	return "hashtags"
+}
+
+func (s *hashtagSink) Publish(ctx context.Context, event events.Event) error {
+	if event.Type != events.ChirpCreated && event.Type != events.ChirpUpdated {
+		return nil
+	}
+	var chirp Chirp
+	if err := json.Unmarshal(event.Data, &chirp); err != nil {
+		return err
+	}
+	return s.srv.withTx(ctx, func(q *database.Queries) error {
+		current, err := q.GetChirp(ctx, chirp.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// the chirp has been deleted since
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tagChirp(ctx, q, current.ID, current.Body)
+	})
+}
+
+// tagChirp links a chirp to the hashtags found in its sanitized body, replacing any previous tags.
+func tagChirp(ctx context.Context, q *database.Queries, chirpID uuid.UUID, body string) error {
+	if err := q.ClearChirpHashtags(ctx, chirpID); err != nil {
+		return err
+	}
+
+	tags := extractHashtags(body)
+	if len(tags) == 0 {
+		return nil
+	}
+	return q.TagChirp(ctx, database.TagChirpParams{
+		Tags:    tags,
+		ChirpID: chirpID,
+	})
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/szmktk/chirpy/internal/config"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "no tags", body: "Hello world!", want: nil},
+		{name: "single tag", body: "Learning #Go today", want: []string{"go"}},
+		{name: "trailing punctuation", body: "So #fun! and #cool, right?", want: []string{"fun", "cool"}},
+		{name: "duplicates are collapsed", body: "#go #GO #Go", want: []string{"go"}},
+		{name: "underscores and digits", body: "#web_dev #2025", want: []string{"web_dev", "2025"}},
+		{name: "unicode letters", body: "#zażółć", want: []string{"zażółć"}},
+		{name: "hash inside word is not a tag", body: "C#sharp issue#42", want: nil},
+		{name: "bare hash", body: "# #! ##", want: nil},
+		{name: "forbidden words never become tags", body: sanitizeInput("#Kerfuffle kerfuffle #sharbert! #ok"), want: []string{"ok"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractHashtags(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractHashtags(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashtagSink(t *testing.T) {
+	chirpID := uuid.New()
+	userID := uuid.New()
+
+	tests := []struct {
+		name      string
+		eventType string
+		setupMock func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:      "created chirp",
+			eventType: events.ChirpCreated,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("FROM chirps").
+					WithArgs(chirpID).
+					WillReturnRows(sqlmock.NewRows(chirpColumns).AddRow(chirpID, time.Now(), time.Now(), "Learning #Go", userID, nil, nil))
+				mock.ExpectExec("DELETE FROM chirp_hashtags").
+					WithArgs(chirpID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("INSERT INTO hashtags").
+					WithArgs(pq.Array([]string{"go"}), chirpID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			// tags follow the current body, whatever the body was when the event was recorded
+			name:      "edited chirp",
+			eventType: events.ChirpUpdated,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("FROM chirps").
+					WithArgs(chirpID).
+					WillReturnRows(sqlmock.NewRows(chirpColumns).AddRow(chirpID, time.Now(), time.Now(), "No tags anymore", userID, nil, nil))
+				mock.ExpectExec("DELETE FROM chirp_hashtags").
+					WithArgs(chirpID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:      "deleted chirp",
+			eventType: events.ChirpUpdated,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("FROM chirps").
+					WithArgs(chirpID).
+					WillReturnRows(sqlmock.NewRows(chirpColumns))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:      "other events are skipped",
+			eventType: events.ChirpLiked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+			if tt.setupMock != nil {
+				tt.setupMock(mock)
+			}
+
+			data, err := json.Marshal(Chirp{ID: chirpID, Body: "Learning #Go", UserID: userID})
+			if err != nil {
+				t.Fatalf("failed to encode event data: %v", err)
+			}
+			event := events.Event{ID: uuid.New(), Type: tt.eventType, UserID: userID, OccurredAt: time.Now(), Data: data}
+			if err := srv.HashtagSink().Publish(context.Background(), event); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
@@ -2,29 +2,87 @@ package server
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/szmktk/chirpy/internal/auth"
 )
 
 type contextKey string
 
-const contextKeyUserID contextKey = "userID"
+const (
+	contextKeyUserID contextKey = "userID"
+	contextKeyClaims contextKey = "claims"
+)
 
-// authMiddleware extracts and validates the Bearer JWT token, storing the user ID in context.
-func (srv *Server) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
+// AuthMiddleware authenticates the request with a Bearer JWT or an ApiKey, storing the user ID and the claims in context.
+// Requests with credentials lacking any of the given scopes are rejected with 403. Failed authentication attempts
+// count against LimitAuthFailures per client IP, which is checked before the credentials are looked up.
+func (srv *Server) AuthMiddleware(next http.HandlerFunc, scopes ...string) http.HandlerFunc {
+	return srv.Handler(srv.RateLimit(func(w http.ResponseWriter, r *http.Request) error {
+		claims, scheme, err := srv.authenticate(r)
 		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-			return
+			return err
+		}
+		// only failed attempts count against the limit
+		if srv.rateLimiter != nil {
+			if err := srv.rateLimiter.Refund(r.Context(), LimitAuthFailures, "ip:"+srv.clientIP(r)); err != nil {
+				srv.logger.Error("Error refunding rate limit", "limit", LimitAuthFailures.Name, "err", err)
+			}
+		}
+		if !claims.HasScopes(scopes...) {
+			// RFC 6750 section 3.1
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`%s error="insufficient_scope", scope="%s"`, scheme, strings.Join(scopes, " ")))
+			return APIError{Status: http.StatusForbidden, Msg: "Token lacks the required scope"}
+		}
+		ctx := context.WithValue(r.Context(), contextKeyUserID, claims.UserID)
+		ctx = context.WithValue(ctx, contextKeyClaims, claims)
+		next(w, r.WithContext(ctx))
+		return nil
+	}, LimitAuthFailures))
+}
+
+// authenticate resolves the credentials of the request into claims, returning the authorization scheme used.
+// Personal API keys are looked up by their hash; an access token is validated by its signature alone.
+func (srv *Server) authenticate(r *http.Request) (auth.Claims, string, error) {
+	if key, err := auth.GetApiKey(r.Header); err == nil {
+		apiKey, err := srv.db.UseAPIKey(r.Context(), auth.HashToken(key))
+		if errors.Is(err, sql.ErrNoRows) {
+			return auth.Claims{}, "", APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
 		}
-		userID, err := auth.ValidateJWT(token, srv.cfg.TokenSecret)
 		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			srv.logger.Error("Error looking up API key", "err", err)
+			return auth.Claims{}, "", APIError{Status: http.StatusInternalServerError, Msg: "Internal Server Error"}
+		}
+		return auth.Claims{
+			UserID:    apiKey.UserID,
+			Scopes:    apiKey.Scopes,
+			ExpiresAt: apiKey.ExpiresAt.Time,
+		}, "ApiKey", nil
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return auth.Claims{}, "", APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+	claims, err := auth.ValidateJWT(token, srv.keys)
+	if err != nil {
+		return auth.Claims{}, "", APIError{Status: http.StatusUnauthorized, Msg: "Unauthorized"}
+	}
+	return claims, "Bearer", nil
+}
+
+// OptionalAuthMiddleware behaves like AuthMiddleware when credentials are present,
+// but lets anonymous requests through without a user ID in context.
+func (srv *Server) OptionalAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next(w, r)
 			return
 		}
-		ctx := context.WithValue(r.Context(), contextKeyUserID, userID)
-		next(w, r.WithContext(ctx))
+		srv.AuthMiddleware(next)(w, r)
 	}
 }
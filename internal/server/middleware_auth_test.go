@@ -0,0 +1,200 @@
+package server
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestAuthMiddleware_Scopes(t *testing.T) {
+	srv, err := NewServer(&config.Config{TokenSecret: "secret"}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	userID := uuid.New()
+
+	tests := []struct {
+		name                    string
+		scopes                  []string
+		noToken                 bool
+		expectedStatus          int
+		expectedWWWAuthenticate string
+	}{
+		{
+			name:           "login token",
+			scopes:         auth.AllScopes,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "token with the required scope",
+			scopes:         []string{auth.ScopeChirpsWrite},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:                    "token lacking the required scope",
+			scopes:                  []string{auth.ScopeChirpsRead},
+			expectedStatus:          http.StatusForbidden,
+			expectedWWWAuthenticate: `Bearer error="insufficient_scope", scope="chirps:write"`,
+		},
+		{
+			name:           "no token",
+			noToken:        true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var claims auth.Claims
+			handler := srv.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				claims, _ = r.Context().Value(contextKeyClaims).(auth.Claims)
+				w.WriteHeader(http.StatusOK)
+			}, auth.ScopeChirpsWrite)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+			if !tt.noToken {
+				token, err := auth.MakeJWT(userID, tt.scopes, srv.keys, time.Hour)
+				if err != nil {
+					t.Fatalf("failed to make token: %v", err)
+				}
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.expectedWWWAuthenticate {
+				t.Errorf("expected WWW-Authenticate %q, got %q", tt.expectedWWWAuthenticate, got)
+			}
+			if tt.expectedStatus == http.StatusOK && claims.UserID != userID {
+				t.Errorf("expected claims of user %s in context, got %+v", userID, claims)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_ApiKey(t *testing.T) {
+	apiKeyColumns := []string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "created_at", "expires_at", "last_used_at", "revoked_at"}
+	userID := uuid.New()
+
+	tests := []struct {
+		name           string
+		found          bool
+		scopes         string
+		expectedStatus int
+	}{
+		{
+			name:           "valid key",
+			found:          true,
+			scopes:         "{chirps:write}",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "key lacking the required scope",
+			found:          true,
+			scopes:         "{chirps:read}",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "unknown, expired or revoked key",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{TokenSecret: "secret"}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			use := mock.ExpectQuery("UPDATE api_keys").WithArgs(auth.HashToken("chirpy_key"))
+			if tt.found {
+				use.WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+					AddRow(uuid.New(), userID, "CI", "chirpy_12345678", auth.HashToken("chirpy_key"), tt.scopes, time.Now(), nil, time.Now(), nil))
+			} else {
+				use.WillReturnError(sql.ErrNoRows)
+			}
+
+			var contextUserID uuid.UUID
+			handler := srv.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				contextUserID, _ = r.Context().Value(contextKeyUserID).(uuid.UUID)
+				w.WriteHeader(http.StatusOK)
+			}, auth.ScopeChirpsWrite)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+			req.Header.Set("Authorization", "ApiKey chirpy_key")
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus == http.StatusOK && contextUserID != userID {
+				t.Errorf("expected user %s in context, got %s", userID, contextUserID)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_FailureLimit(t *testing.T) {
+	srv, err := NewServer(&config.Config{TokenSecret: "secret"}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	token, err := auth.MakeJWT(uuid.New(), auth.AllScopes, srv.keys, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+	handler := srv.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, auth.ScopeChirpsWrite)
+	request := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	// successful attempts do not count against the limit
+	for i := 0; i < LimitAuthFailures.Requests+1; i++ {
+		if w := request("Bearer " + token); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status %d, got %d", i, http.StatusOK, w.Code)
+		}
+	}
+	for i := 0; i < LimitAuthFailures.Requests; i++ {
+		if w := request("Bearer invalid"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d: expected status %d, got %d", i, http.StatusUnauthorized, w.Code)
+		}
+	}
+	// once the limit is exceeded credentials are not checked at all
+	w := request("Bearer " + token)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/ratelimit"
+)
+
+// premiumRateLimitFactor multiplies the rate limits of users with the higher rate limits feature.
+const premiumRateLimitFactor = 5
+
+// Per-route rate limits. Authenticated requests are limited per user, anonymous ones per client IP.
+var (
+	// LimitReads applies to listing and reading chirps, users and notifications.
+	LimitReads = ratelimit.Limit{Name: "reads", Requests: 300, Period: time.Minute}
+	// LimitWrites applies to authenticated changes other than posting chirps.
+	LimitWrites = ratelimit.Limit{Name: "writes", Requests: 60, Period: time.Minute}
+	// LimitChirpCreate applies to posting chirps.
+	LimitChirpCreate = ratelimit.Limit{Name: "chirps:create", Requests: 100, Period: time.Hour}
+	// LimitAuth applies to signing up, logging in and other credential exchanges.
+	LimitAuth = ratelimit.Limit{Name: "auth", Requests: 20, Period: time.Minute}
+	// LimitEmail applies to endpoints sending emails.
+	LimitEmail = ratelimit.Limit{Name: "email", Requests: 5, Period: time.Hour}
+	// LimitWebhooks applies to webhooks received from payment providers, always per client IP.
+	LimitWebhooks = ratelimit.Limit{Name: "webhooks", Requests: 120, Period: time.Minute}
+	// LimitAuthFailures applies to failed authentication with a Bearer JWT or an ApiKey, always per client IP.
+	LimitAuthFailures = ratelimit.Limit{Name: "auth:failures", Requests: 30, Period: time.Minute}
+)
+
+// RateLimit rejects requests exceeding any of the limits with 429 and reports the most constrained
+// limit in RateLimit-* headers. It must run after authentication for requests to be limited per user.
+// A rejected request gives back the tokens it took under the other limits, so it only counts against
+// the limit it exceeded. Errors of the rate limit store are logged and let the request through.
+func (srv *Server) RateLimit(next apiFunc, limits ...ratelimit.Limit) apiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if srv.rateLimiter == nil {
+			return next(w, r)
+		}
+
+		key := "ip:" + srv.clientIP(r)
+		limits := limits
+		if userID, ok := r.Context().Value(contextKeyUserID).(uuid.UUID); ok {
+			key = "user:" + userID.String()
+			limits = srv.userLimits(r.Context(), userID, limits)
+		}
+
+		var constrained *ratelimit.Result
+		var constrainedLimit ratelimit.Limit
+		var taken []ratelimit.Limit
+		for _, limit := range limits {
+			result, err := srv.rateLimiter.Allow(r.Context(), limit, key)
+			if err != nil {
+				srv.logger.Error("Error checking rate limit", "limit", limit.Name, "err", err)
+				continue
+			}
+			if constrained == nil || !result.Allowed || (constrained.Allowed && result.Remaining < constrained.Remaining) {
+				constrained, constrainedLimit = &result, limit
+			}
+			if !result.Allowed {
+				break
+			}
+			taken = append(taken, limit)
+		}
+		if constrained == nil {
+			return next(w, r)
+		}
+		if !constrained.Allowed {
+			for _, limit := range taken {
+				if err := srv.rateLimiter.Refund(r.Context(), limit, key); err != nil {
+					srv.logger.Error("Error refunding rate limit", "limit", limit.Name, "err", err)
+				}
+			}
+		}
+
+		// draft-ietf-httpapi-ratelimit-headers
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(constrained.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(constrained.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(constrained.Reset)))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", constrainedLimit.Requests, ceilSeconds(constrainedLimit.Period)))
+
+		if !constrained.Allowed {
+			srv.logger.Info("Rate limit exceeded", "limit", constrainedLimit.Name, "key", key)
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(constrained.RetryAfter)))
+			return APIError{Status: http.StatusTooManyRequests, Msg: "Rate limit exceeded, try again later"}
+		}
+		return next(w, r)
+	}
+}
+
+// userLimits multiplies the limits by premiumRateLimitFactor for users with the higher rate limits feature.
+func (srv *Server) userLimits(ctx context.Context, userID uuid.UUID, limits []ratelimit.Limit) []ratelimit.Limit {
+	entitlements, err := srv.entitlements(ctx, userID)
+	if err != nil {
+		srv.logger.Error("Error getting entitlements", "user_id", userID, "err", err)
+		return limits
+	}
+	if !entitlements.Has(FeatureHigherRateLimits) {
+		return limits
+	}
+	premium := make([]ratelimit.Limit, len(limits))
+	for i, limit := range limits {
+		limit.Requests *= premiumRateLimitFactor
+		premium[i] = limit
+	}
+	return premium
+}
+
+// ceilSeconds rounds a duration up to whole seconds, as used by HTTP headers.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
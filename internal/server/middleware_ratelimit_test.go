@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+	"github.com/szmktk/chirpy/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	perMinute := ratelimit.Limit{Name: "test:minute", Requests: 2, Period: time.Minute}
+	perHour := ratelimit.Limit{Name: "test:hour", Requests: 5, Period: time.Hour}
+	handler := srv.RateLimit(func(w http.ResponseWriter, r *http.Request) error {
+		respondWithNoContent(w)
+		return nil
+	}, perMinute, perHour)
+
+	request := func(remoteAddr string, userID uuid.UUID) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+		req.RemoteAddr = remoteAddr
+		if userID != uuid.Nil {
+			req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+		}
+		w := httptest.NewRecorder()
+		return w, handler(w, req)
+	}
+
+	w, err := request("192.0.2.1:1234", uuid.Nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for header, want := range map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "1",
+		"RateLimit-Reset":     "30",
+		"RateLimit-Policy":    "2;w=60",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("expected %s %q, got %q", header, want, got)
+		}
+	}
+
+	if _, err := request("192.0.2.1:1234", uuid.Nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w, err = request("192.0.2.1:5678", uuid.Nil)
+	apiErr, ok := err.(APIError)
+	if !ok || apiErr.Status != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 APIError, got %v", err)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After %q, got %q", "30", got)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("expected RateLimit-Remaining %q, got %q", "0", got)
+	}
+
+	// authenticated requests are limited per user, not per IP
+	userID := uuid.New()
+	mock.ExpectQuery("SELECT (.+) FROM subscriptions").WithArgs(userID).WillReturnError(sql.ErrNoRows)
+	if _, err := request("192.0.2.1:1234", userID); err != nil {
+		t.Errorf("expected a request of a user to not be limited by its IP, got %v", err)
+	}
+	if _, err := request("192.0.2.2:1234", uuid.Nil); err != nil {
+		t.Errorf("expected a request from another IP to not be limited, got %v", err)
+	}
+}
+
+func TestRateLimit_RejectedRequestsAreRefunded(t *testing.T) {
+	srv, err := NewServer(&config.Config{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	loose := ratelimit.Limit{Name: "test:loose", Requests: 10, Period: time.Minute}
+	tight := ratelimit.Limit{Name: "test:tight", Requests: 1, Period: time.Minute}
+	handler := srv.RateLimit(func(w http.ResponseWriter, r *http.Request) error {
+		respondWithNoContent(w)
+		return nil
+	}, loose, tight)
+
+	for i := range 3 {
+		req := httptest.NewRequest(http.MethodPost, "/api/users/me/verify/resend", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		err := handler(httptest.NewRecorder(), req)
+		if _, rejected := err.(APIError); rejected != (i > 0) {
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+	}
+
+	// only the allowed request counts against the loose limit
+	result, err := srv.rateLimiter.Allow(context.Background(), loose, "ip:192.0.2.1")
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if result.Remaining != 8 {
+		t.Errorf("expected 8 requests to remain under the loose limit, got %d", result.Remaining)
+	}
+}
+
+func TestRateLimit_HigherLimits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	limit := ratelimit.Limit{Name: "test", Requests: 2, Period: time.Minute}
+	handler := srv.RateLimit(func(w http.ResponseWriter, r *http.Request) error {
+		respondWithNoContent(w)
+		return nil
+	}, limit)
+
+	userID := uuid.New()
+	mock.ExpectQuery("SELECT (.+) FROM subscriptions").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows(subscriptionColumns).AddRow(mockSubscriptionRow(userID, "chirpy_red")...))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUserID, userID))
+	w := httptest.NewRecorder()
+	if err := handler(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "10" {
+		t.Errorf("expected the limit of Chirpy Red members to be raised to %q, got %q", "10", got)
+	}
+	if limit.Requests != 2 {
+		t.Errorf("expected the route limit to not be modified, got %d", limit.Requests)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestRateLimit_Disabled(t *testing.T) {
+	srv, err := NewServer(&config.Config{RateLimitStore: "none"}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	handler := srv.RateLimit(func(w http.ResponseWriter, r *http.Request) error {
+		respondWithNoContent(w)
+		return nil
+	}, ratelimit.Limit{Name: "test", Requests: 1, Period: time.Hour})
+
+	for range 3 {
+		w := httptest.NewRecorder()
+		if err := handler(w, httptest.NewRequest(http.MethodGet, "/api/chirps", nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "" {
+			t.Errorf("expected no rate limit headers, got %q", got)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+const (
+	notificationMention string = "mention"
+	notificationReply   string = "reply"
+	notificationLike    string = "like"
+	notificationFollow  string = "follow"
+)
+
+// extractMentions returns the normalized, de-duplicated @usernames found in a chirp body.
+// Words that cannot be valid usernames are skipped.
+func extractMentions(body string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, word := range strings.Fields(body) {
+		if !strings.HasPrefix(word, "@") {
+			continue
+		}
+		username := strings.TrimPrefix(word, "@")
+		if end := strings.IndexFunc(username, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+		}); end >= 0 {
+			username = username[:end]
+		}
+		username = strings.ToLower(username)
+		if !usernamePattern.MatchString(username) || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// notificationSink notifies users about the chirp.created, chirp.liked and user.followed events
+// concerning them. Notifications are created once per event, so publishing an event again has no effect.
+// Users are not notified about their own actions.
+type notificationSink struct {
+	srv *Server
+}
+
+// NotificationSink returns the events.Sink driving the notifications inbox.
+func (srv *Server) NotificationSink() events.Sink {
+	return &notificationSink{srv: srv}
+}
+
+func (s *notificationSink) Name() string {
+	return "notifications"
+}
+
+func (s *notificationSink) Publish(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.ChirpCreated:
+		var chirp Chirp
+		if err := json.Unmarshal(event.Data, &chirp); err != nil {
+			return err
+		}
+		return s.notifyChirp(ctx, event.ID, chirp)
+	case events.ChirpLiked:
+		var like struct {
+			ChirpID uuid.UUID `json:"chirp_id"`
+			UserID  uuid.UUID `json:"user_id"`
+		}
+		if err := json.Unmarshal(event.Data, &like); err != nil {
+			return err
+		}
+		return s.notify(ctx, event.ID, event.UserID, like.UserID, notificationLike, uuid.NullUUID{UUID: like.ChirpID, Valid: true})
+	case events.UserFollowed:
+		var follow struct {
+			FollowerID uuid.UUID `json:"follower_id"`
+		}
+		if err := json.Unmarshal(event.Data, &follow); err != nil {
+			return err
+		}
+		return s.notify(ctx, event.ID, event.UserID, follow.FollowerID, notificationFollow, uuid.NullUUID{})
+	default:
+		return nil
+	}
+}
+
+// notifyChirp notifies the author of the chirp being replied to, unless it has been deleted since,
+// and every existing user mentioned in the chirp.
+func (s *notificationSink) notifyChirp(ctx context.Context, eventID uuid.UUID, chirp Chirp) error {
+	chirpID := uuid.NullUUID{UUID: chirp.ID, Valid: true}
+	if chirp.InReplyTo != nil {
+		parent, err := s.srv.db.GetChirp(ctx, *chirp.InReplyTo)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err == nil {
+			if err := s.notify(ctx, eventID, parent.UserID, chirp.UserID, notificationReply, chirpID); err != nil {
+				return err
+			}
+		}
+	}
+
+	usernames := extractMentions(chirp.Body)
+	if len(usernames) == 0 {
+		return nil
+	}
+	return s.srv.db.CreateMentionNotifications(ctx, database.CreateMentionNotificationsParams{
+		ActorID:   chirp.UserID,
+		ChirpID:   chirp.ID,
+		EventID:   eventID,
+		Usernames: usernames,
+	})
+}
+
+// notify records a notification for userID about an action taken by actorID.
+func (s *notificationSink) notify(ctx context.Context, eventID, userID, actorID uuid.UUID, kind string, chirpID uuid.NullUUID) error {
+	return s.srv.db.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:  userID,
+		ActorID: actorID,
+		Type:    kind,
+		ChirpID: chirpID,
+		EventID: eventID,
+	})
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/szmktk/chirpy/internal/config"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "no mentions", body: "Hello world!", want: nil},
+		{name: "single mention", body: "Hi @Alice how are you", want: []string{"alice"}},
+		{name: "trailing punctuation", body: "@bob, @carol_99!", want: []string{"bob", "carol_99"}},
+		{name: "duplicates are collapsed", body: "@bob @BOB @Bob", want: []string{"bob"}},
+		{name: "too short", body: "@ab", want: nil},
+		{name: "not a valid username", body: "@zażółć", want: nil},
+		{name: "email address is not a mention", body: "mail me at bob@example.com", want: nil},
+		{name: "bare at sign", body: "@ @! @@", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractMentions(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractMentions(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotificationSink(t *testing.T) {
+	eventID := uuid.New()
+	authorID := uuid.New()
+	actorID := uuid.New()
+	chirpID := uuid.New()
+	parentID := uuid.New()
+
+	tests := []struct {
+		name      string
+		eventType string
+		userID    uuid.UUID
+		data      any
+		setupMock func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:      "reply with mentions",
+			eventType: events.ChirpCreated,
+			userID:    actorID,
+			data:      Chirp{ID: chirpID, Body: "@alice @bob look", UserID: actorID, InReplyTo: &parentID},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM chirps").
+					WithArgs(parentID).
+					WillReturnRows(sqlmock.NewRows(chirpColumns).AddRow(parentID, time.Now(), time.Now(), "hello", authorID, nil, nil))
+				mock.ExpectExec("INSERT INTO notifications").
+					WithArgs(authorID, actorID, notificationReply, chirpID, eventID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO notifications").
+					WithArgs(actorID, chirpID, eventID, pq.Array([]string{"alice", "bob"})).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+			},
+		},
+		{
+			name:      "reply to a deleted chirp",
+			eventType: events.ChirpCreated,
+			userID:    actorID,
+			data:      Chirp{ID: chirpID, Body: "hello", UserID: actorID, InReplyTo: &parentID},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM chirps").
+					WithArgs(parentID).
+					WillReturnRows(sqlmock.NewRows(chirpColumns))
+			},
+		},
+		{
+			name:      "like",
+			eventType: events.ChirpLiked,
+			userID:    authorID,
+			data:      map[string]uuid.UUID{"chirp_id": chirpID, "user_id": actorID},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO notifications").
+					WithArgs(authorID, actorID, notificationLike, chirpID, eventID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:      "follow",
+			eventType: events.UserFollowed,
+			userID:    authorID,
+			data:      map[string]uuid.UUID{"follower_id": actorID, "followee_id": authorID},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO notifications").
+					WithArgs(authorID, actorID, notificationFollow, nil, eventID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:      "other events are skipped",
+			eventType: events.ChirpDeleted,
+			userID:    authorID,
+			data:      Chirp{ID: chirpID, UserID: authorID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+			if tt.setupMock != nil {
+				tt.setupMock(mock)
+			}
+
+			data, err := json.Marshal(tt.data)
+			if err != nil {
+				t.Fatalf("failed to encode event data: %v", err)
+			}
+			event := events.Event{ID: eventID, Type: tt.eventType, UserID: tt.userID, OccurredAt: time.Now(), Data: data}
+			if err := srv.NotificationSink().Publish(context.Background(), event); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit int = 20
+	maxPageLimit     int = 100
+)
+
+// pageCursor identifies the last item of a page by the keyset the results are ordered by.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	// Rank is only set for results ordered by search relevance.
+	Rank *float32 `json:"r,omitempty"`
+}
+
+// pageParams holds the pagination parameters parsed from the request query string.
+type pageParams struct {
+	Limit  int
+	Cursor *pageCursor
+}
+
+// parsePageParams reads the `limit` and `cursor` query parameters.
+// Returns an APIError if either of them is malformed.
+func parsePageParams(r *http.Request) (pageParams, error) {
+	params := pageParams{Limit: defaultPageLimit}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return pageParams{}, APIError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("Limit must be a number between 1 and %d", maxPageLimit)}
+		}
+		params.Limit = limit
+	}
+
+	if cursorStr := r.URL.Query().Get("cursor"); cursorStr != "" {
+		cursor, err := decodeCursor(cursorStr)
+		if err != nil {
+			return pageParams{}, APIError{Status: http.StatusBadRequest, Msg: "Invalid cursor"}
+		}
+		params.Cursor = &cursor
+	}
+
+	return params, nil
+}
+
+// rowLimit is the number of rows to fetch from the database.
+// One extra row is requested so that the presence of a next page can be detected.
+func (p pageParams) rowLimit() int32 {
+	return int32(p.Limit + 1)
+}
+
+// cursorArgs converts the cursor into nullable query arguments.
+func (p pageParams) cursorArgs() (sql.NullTime, uuid.NullUUID) {
+	if p.Cursor == nil {
+		return sql.NullTime{}, uuid.NullUUID{}
+	}
+	return sql.NullTime{Time: p.Cursor.CreatedAt, Valid: true}, uuid.NullUUID{UUID: p.Cursor.ID, Valid: true}
+}
+
+// paginate trims the extra row fetched by rowLimit and returns the cursor pointing at the last
+// item of the page, or an empty string when there are no more results.
+func paginate[T any](rows []T, p pageParams, keyOf func(T) pageCursor) ([]T, string) {
+	if len(rows) <= p.Limit {
+		return rows, ""
+	}
+	rows = rows[:p.Limit]
+	return rows, encodeCursor(keyOf(rows[len(rows)-1]))
+}
+
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, err
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return pageCursor{}, err
+	}
+	if c.CreatedAt.IsZero() || c.ID == uuid.Nil {
+		return pageCursor{}, errors.New("incomplete cursor")
+	}
+	return c, nil
+}
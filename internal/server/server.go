@@ -1,28 +1,165 @@
 package server
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"log/slog"
+	"sync"
 	"sync/atomic"
 
 	_ "github.com/lib/pq"
+	"github.com/szmktk/chirpy/internal/auth"
 	"github.com/szmktk/chirpy/internal/config"
 	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/lockout"
+	"github.com/szmktk/chirpy/internal/mail"
+	"github.com/szmktk/chirpy/internal/ratelimit"
 )
 
 type Server struct {
 	cfg            *config.Config
+	conn           *sql.DB
 	db             *database.Queries
 	logger         *slog.Logger
+	mailer         mail.Mailer
+	keys           *auth.KeySet
+	accountLockout *lockout.Limiter
+	ipLockout      *lockout.Limiter
+	rateLimiter    *ratelimit.Limiter
+	planFeatures   map[string]map[Feature]bool
 	fileserverHits atomic.Int32
+	// background tracks work started by handlers that outlives the request.
+	background sync.WaitGroup
 }
 
-func NewServer(cfg *config.Config, db *database.Queries, logger *slog.Logger) (*Server, error) {
+func NewServer(cfg *config.Config, conn *sql.DB, logger *slog.Logger) (*Server, error) {
+	db := database.New(conn)
 	srv := &Server{
 		cfg:            cfg,
+		conn:           conn,
 		db:             db,
 		logger:         logger,
 		fileserverHits: atomic.Int32{},
 	}
 
+	mailer, err := newMailer(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	srv.mailer = mailer
+
+	keys, err := newKeySet(cfg)
+	if err != nil {
+		return nil, err
+	}
+	srv.keys = keys
+
+	var lockoutStore lockout.Store = lockout.NewMemoryStore()
+	if cfg.LoginLockoutStore == "postgres" {
+		lockoutStore = lockout.NewPostgresStore(db)
+	}
+	srv.accountLockout = lockout.New(lockoutStore, lockout.Policy{
+		Threshold: cfg.LoginMaxFailures,
+		BaseDelay: cfg.LoginLockoutBaseDelay,
+		MaxDelay:  cfg.LoginLockoutMaxDelay,
+		Window:    cfg.LoginLockoutWindow,
+	})
+	srv.ipLockout = lockout.New(lockoutStore, lockout.Policy{
+		Threshold: cfg.LoginMaxFailuresPerIP,
+		BaseDelay: cfg.LoginLockoutBaseDelay,
+		MaxDelay:  cfg.LoginLockoutMaxDelay,
+		Window:    cfg.LoginLockoutWindow,
+	})
+
+	planFeatures, err := newPlanFeatures(cfg)
+	if err != nil {
+		return nil, err
+	}
+	srv.planFeatures = planFeatures
+
+	switch cfg.RateLimitStore {
+	case "postgres":
+		srv.rateLimiter = ratelimit.New(ratelimit.NewPostgresStore(db))
+	case "none":
+	default:
+		srv.rateLimiter = ratelimit.New(ratelimit.NewMemoryStore())
+	}
+
 	return srv, nil
 }
+
+// withTx runs fn with queries bound to a transaction, which is committed unless fn returns an error.
+// Errors of fn are returned as they are, so handlers can return an APIError from within the transaction.
+func (srv *Server) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := srv.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(srv.db.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Shutdown waits for background work started by handlers, e.g. password reset emails, to finish.
+// Call it once the HTTP server stopped accepting requests. It gives up when the context ends first.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		srv.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newKeySet builds the JWT key set: tokens are signed with the configured private key, or with
+// the HMAC secret when there is none. The HMAC secret keeps verifying tokens issued before
+// switching to a private key, and the additional verification keys allow rotating it.
+func newKeySet(cfg *config.Config) (*auth.KeySet, error) {
+	var hmacKey *auth.Key
+	if cfg.TokenSecret != "" || cfg.JWTSigningKeyFile == "" {
+		hmacKey = auth.NewHMACKey([]byte(cfg.TokenSecret))
+	}
+	if cfg.JWTSigningKeyFile == "" {
+		return auth.NewKeySet(hmacKey)
+	}
+
+	signingKey, err := auth.LoadPEMKey(cfg.JWTSigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading JWT signing key: %w", err)
+	}
+	var verificationKeys []*auth.Key
+	if hmacKey != nil {
+		verificationKeys = append(verificationKeys, hmacKey)
+	}
+	for _, path := range cfg.JWTVerificationKeyFiles {
+		key, err := auth.LoadPEMKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading JWT verification key: %w", err)
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+	return auth.NewKeySet(signingKey, verificationKeys...)
+}
+
+func newMailer(cfg *config.Config, logger *slog.Logger) (mail.Mailer, error) {
+	switch cfg.Mailer {
+	case "smtp":
+		return mail.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "file":
+		return mail.NewFileMailer(cfg.MailDir, cfg.MailFrom)
+	case "log", "":
+		return mail.NewLogMailer(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer: %q", cfg.Mailer)
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+// subscriptionExpired is the event of subscription.updated events recorded when a paid period ends
+// without a renewal.
+const subscriptionExpired = "subscription.expired"
+
+// RunSubscriptionExpiry expires lapsed subscriptions every interval until the context is done,
+// so users lose Chirpy Red once their paid period ends without a renewal.
+func (srv *Server) RunSubscriptionExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		srv.expireSubscriptions(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireSubscriptions expires lapsed subscriptions and records a subscription.updated event for each of them
+// in the same transaction.
+func (srv *Server) expireSubscriptions(ctx context.Context) {
+	var expired []database.ExpireSubscriptionsRow
+	err := srv.withTx(ctx, func(q *database.Queries) error {
+		var err error
+		expired, err = q.ExpireSubscriptions(ctx)
+		if err != nil {
+			return err
+		}
+		for _, subscription := range expired {
+			err := events.Record(ctx, q, events.SubscriptionUpdated, subscription.ID, subscriptionUpdate{
+				Event:            subscriptionExpired,
+				Plan:             subscription.Plan,
+				Status:           "expired",
+				CurrentPeriodEnd: subscription.CurrentPeriodEnd,
+				IsChirpyRed:      false,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		srv.logger.Error("Error expiring subscriptions", "err", err)
+		return
+	}
+	for _, subscription := range expired {
+		srv.logger.Info("Subscription expired", "user_id", subscription.ID)
+	}
+}
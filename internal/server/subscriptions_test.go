@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/config"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+func TestRunSubscriptionExpiry(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	srv, err := NewServer(&config.Config{}, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	periodEnd := time.Now().Add(-time.Minute)
+	expired := []uuid.UUID{uuid.New(), uuid.New()}
+	mock.ExpectBegin()
+	mock.ExpectQuery("WITH expired AS").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan", "current_period_end"}).
+			AddRow(expired[0], "chirpy_red", periodEnd).
+			AddRow(expired[1], "chirpy_red", periodEnd))
+	// every expired subscription is recorded as an event in the same transaction
+	for _, userID := range expired {
+		mock.ExpectExec("INSERT INTO outbox").
+			WithArgs(sqlmock.AnyArg(), events.SubscriptionUpdated, userID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		srv.RunSubscriptionExpiry(ctx, time.Hour)
+		close(done)
+	}()
+
+	// the job runs right away instead of waiting for the first tick
+	deadline := time.Now().Add(time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the expiry job to stop once the context is done")
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// webhookAuditLogPruneInterval is how often audit log entries older than the retention are deleted.
+const webhookAuditLogPruneInterval = time.Hour
+
+// RunWebhookAuditLogPruning deletes webhook audit log entries older than the configured retention
+// right away and then every hour, until the context is done.
+func (srv *Server) RunWebhookAuditLogPruning(ctx context.Context) {
+	ticker := time.NewTicker(webhookAuditLogPruneInterval)
+	defer ticker.Stop()
+	for {
+		srv.pruneWebhookAuditLog(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (srv *Server) pruneWebhookAuditLog(ctx context.Context) {
+	deleted, err := srv.db.DeleteWebhookAuditLog(ctx, srv.cfg.WebhookAuditLogRetention.Seconds())
+	if err != nil {
+		srv.logger.Error("Error pruning webhook audit log", "err", err)
+		return
+	}
+	if deleted > 0 {
+		srv.logger.Info("Pruned webhook audit log", "deleted", deleted)
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/szmktk/chirpy/internal/config"
+)
+
+func TestPruneWebhookAuditLog(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	cfg := &config.Config{WebhookAuditLogRetention: 30 * 24 * time.Hour}
+	srv, err := NewServer(cfg, db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	mock.ExpectExec("DELETE FROM webhook_audit_log").
+		WithArgs(float64(30 * 24 * 60 * 60)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	srv.pruneWebhookAuditLog(context.Background())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
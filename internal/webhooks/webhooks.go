@@ -0,0 +1,85 @@
+// Package webhooks delivers events to HTTP endpoints registered by users.
+//
+// Queue, the events.Sink for webhooks, queues one delivery per subscribed endpoint, sent by a Worker
+// in the background. Payloads are signed like incoming Polka webhooks: the Chirpy-Signature header carries
+// an HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret of the endpoint (see auth.SignWebhook).
+// Failed deliveries are retried with exponential back-off, and every attempt is recorded.
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+// Event types endpoints can subscribe to. Endpoints receive the events of their owner's account.
+const (
+	// EventChirpCreated is sent when the user posts a chirp.
+	EventChirpCreated = events.ChirpCreated
+	// EventChirpDeleted is sent when the user deletes a chirp.
+	EventChirpDeleted = events.ChirpDeleted
+	// EventChirpLiked is sent when someone likes a chirp of the user.
+	EventChirpLiked = events.ChirpLiked
+	// EventUserFollowed is sent when someone follows the user.
+	EventUserFollowed = events.UserFollowed
+)
+
+// EventTypes lists every event type, in the order they are documented.
+var EventTypes = []string{EventChirpCreated, EventChirpDeleted, EventChirpLiked, EventUserFollowed}
+
+// IsValidEventType reports whether endpoints can subscribe to the event type.
+func IsValidEventType(eventType string) bool {
+	return slices.Contains(EventTypes, eventType)
+}
+
+// Event is the JSON payload delivered to endpoints.
+type Event struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Queue queues deliveries of events to the endpoints subscribed to them. It is the events.Sink
+// driving webhooks.
+type Queue struct {
+	db *database.Queries
+}
+
+// NewQueue returns a queue backed by the webhook_deliveries table.
+func NewQueue(db *database.Queries) *Queue {
+	return &Queue{db: db}
+}
+
+func (q *Queue) Name() string {
+	return "webhooks"
+}
+
+// Publish queues a delivery of the event to every endpoint of its user subscribed to the event type.
+// Events of other types are skipped, as are endpoints the event has already been queued for.
+func (q *Queue) Publish(ctx context.Context, event events.Event) error {
+	if !IsValidEventType(event.Type) {
+		return nil
+	}
+	payload, err := json.Marshal(Event{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.OccurredAt,
+		Data:      event.Data,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = q.db.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		EventID:   event.ID,
+		EventType: event.Type,
+		Payload:   string(payload),
+		UserID:    event.UserID,
+	})
+	return err
+}
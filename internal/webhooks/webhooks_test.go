@@ -0,0 +1,260 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
+)
+
+var claimColumns = []string{"id", "event_type", "payload", "attempts", "url", "secret"}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 6, want: 32 * time.Second},
+		{attempts: 7, want: time.Minute},
+		{attempts: 100, want: time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.delay(tt.attempts); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestQueuePublish(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	event := events.Event{
+		ID:         uuid.New(),
+		Type:       events.UserFollowed,
+		UserID:     uuid.New(),
+		OccurredAt: time.Now().UTC(),
+		Data:       json.RawMessage(`{"follower_id":"abc"}`),
+	}
+	payload := payloadMatcher{eventType: EventUserFollowed}
+	mock.ExpectExec("INSERT INTO webhook_deliveries").
+		WithArgs(event.ID, EventUserFollowed, &payload, event.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	queue := NewQueue(database.New(db))
+	if err := queue.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if payload.event.ID != event.ID || payload.event.Data.(map[string]any)["follower_id"] != "abc" {
+		t.Errorf("unexpected payload %+v", payload.event)
+	}
+
+	// events endpoints cannot subscribe to are not queued
+	event.Type = events.SubscriptionUpdated
+	if err := queue.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+// payloadMatcher matches a JSON encoded Event of the given type and keeps it for further checks.
+type payloadMatcher struct {
+	eventType string
+	event     Event
+}
+
+func (m *payloadMatcher) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok || json.Unmarshal([]byte(s), &m.event) != nil {
+		return false
+	}
+	return m.event.Type == m.eventType
+}
+
+func TestWorkerProcessBatch(t *testing.T) {
+	const secret = "whsec_test"
+	payload := `{"id":"8c0b7a7e-8a8e-4d1e-9a4f-1f1f6b0f3c11","type":"chirp.created","data":{}}`
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		responseStatus int
+		closed         bool
+		attempts       int32
+		expectStatus   any
+		expectError    bool
+		expectOutcome  func(mock sqlmock.Sqlmock, id uuid.UUID)
+	}{
+		{
+			name:           "delivered",
+			responseStatus: http.StatusNoContent,
+			attempts:       1,
+			expectStatus:   sql.NullInt32{Int32: 204, Valid: true},
+			expectOutcome: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectExec("UPDATE webhook_deliveries SET status = 'succeeded'").
+					WithArgs(id).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:           "retried with back-off",
+			responseStatus: http.StatusInternalServerError,
+			attempts:       3,
+			expectStatus:   sql.NullInt32{Int32: 500, Valid: true},
+			expectError:    true,
+			expectOutcome: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectExec("UPDATE webhook_deliveries SET next_attempt_at").
+					WithArgs(float64(120), id).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:           "given up",
+			responseStatus: http.StatusGone,
+			attempts:       5,
+			expectStatus:   sql.NullInt32{Int32: 410, Valid: true},
+			expectError:    true,
+			expectOutcome: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectExec("UPDATE webhook_deliveries SET status = 'failed'").
+					WithArgs(id).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:         "unreachable",
+			closed:       true,
+			attempts:     1,
+			expectStatus: sql.NullInt32{},
+			expectError:  true,
+			expectOutcome: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectExec("UPDATE webhook_deliveries SET next_attempt_at").
+					WithArgs(float64(30), id).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deliveryID := uuid.New()
+			var received *http.Request
+			var receivedBody []byte
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+				receivedBody, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tt.responseStatus)
+			}))
+			defer receiver.Close()
+			if tt.closed {
+				receiver.Close()
+			}
+
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+			worker := NewWorker(database.New(db), &http.Client{Timeout: 5 * time.Second}, slog.New(slog.NewTextHandler(io.Discard, nil)), policy)
+			worker.now = func() time.Time { return now }
+
+			mock.ExpectQuery("WITH due AS").
+				WithArgs(int32(20), float64(160)).
+				WillReturnRows(sqlmock.NewRows(claimColumns).
+					AddRow(deliveryID, EventChirpCreated, payload, tt.attempts, receiver.URL+"/hooks", secret))
+			var errArg any = sqlmock.AnyArg()
+			if !tt.expectError {
+				errArg = sql.NullString{}
+			}
+			mock.ExpectExec("INSERT INTO webhook_delivery_attempts").
+				WithArgs(deliveryID, tt.expectStatus, errArg, int32(0)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			tt.expectOutcome(mock, deliveryID)
+
+			sent, err := worker.ProcessBatch(context.Background())
+			if err != nil {
+				t.Fatalf("ProcessBatch() error = %v", err)
+			}
+			if sent != 1 {
+				t.Errorf("expected 1 delivery to be sent, got %d", sent)
+			}
+
+			if !tt.closed {
+				if received == nil {
+					t.Fatal("expected the receiver to be called")
+				}
+				if string(receivedBody) != payload {
+					t.Errorf("expected payload %s, got %s", payload, receivedBody)
+				}
+				if got := received.Header.Get(EventHeader); got != EventChirpCreated {
+					t.Errorf("expected %s header %q, got %q", EventHeader, EventChirpCreated, got)
+				}
+				if got := received.Header.Get(DeliveryHeader); got != deliveryID.String() {
+					t.Errorf("expected %s header %q, got %q", DeliveryHeader, deliveryID, got)
+				}
+				signature := received.Header.Get(SignatureHeader)
+				if err := auth.VerifyWebhookSignature([]byte(secret), signature, receivedBody, now, time.Minute); err != nil {
+					t.Errorf("expected a valid signature, got %v", err)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	_, err := NewHTTPClient(time.Second, false).Get(receiver.URL)
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("expected loopback endpoints to be refused, got %v", err)
+	}
+
+	// connections are refused before they are made, so these never reach the network
+	for _, host := range []string{"0.0.0.1", "10.0.0.1", "100.64.0.1", "169.254.169.254", "192.0.0.1", "198.18.0.1", "[fd00::1]", "[64:ff9b::a00:1]", "[::ffff:100.64.0.1]"} {
+		if _, err := NewHTTPClient(time.Second, false).Get("http://" + host + "/"); !errors.Is(err, errPrivateAddress) {
+			t.Errorf("expected %s to be refused, got %v", host, err)
+		}
+	}
+	for _, addr := range []string{"93.184.215.14", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"} {
+		if !isPublicAddr(netip.MustParseAddr(addr)) {
+			t.Errorf("expected %s to be public", addr)
+		}
+	}
+
+	resp, err := NewHTTPClient(time.Second, true).Get(receiver.URL)
+	if err != nil {
+		t.Fatalf("expected private networks to be allowed, got %v", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,170 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/szmktk/chirpy/internal/auth"
+	"github.com/szmktk/chirpy/internal/backoff"
+	"github.com/szmktk/chirpy/internal/database"
+)
+
+const (
+	// SignatureHeader carries the signature of the payload, see auth.SignWebhook.
+	SignatureHeader = "Chirpy-Signature"
+	// EventHeader carries the event type.
+	EventHeader = "Chirpy-Event"
+	// DeliveryHeader carries the delivery ID, which stays the same across retries.
+	DeliveryHeader = "Chirpy-Delivery"
+
+	// maxResponseBytes is how much of a response body is read before the connection is closed.
+	maxResponseBytes = 4 << 10
+)
+
+// RetryPolicy configures how failed deliveries are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts after which a delivery is given up.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled with every further attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy retries for about a day: after 30s, 1m, 2m, ... up to 6h between attempts.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 12, BaseDelay: 30 * time.Second, MaxDelay: 6 * time.Hour}
+
+// delay returns how long to wait after the given number of failed attempts.
+func (p RetryPolicy) delay(attempts int) time.Duration {
+	return backoff.Delay(p.BaseDelay, p.MaxDelay, attempts-1)
+}
+
+// Worker sends queued deliveries. Any number of workers may run against the same database,
+// each delivery is claimed by a single one.
+type Worker struct {
+	db     *database.Queries
+	client *http.Client
+	logger *slog.Logger
+	policy RetryPolicy
+	// BatchSize is the number of deliveries claimed at once.
+	BatchSize int
+	now       func() time.Time
+}
+
+// NewWorker returns a worker sending deliveries with the given client, whose timeout bounds every attempt.
+// Claimed deliveries are sent one after another, see Worker.lease for how long they are reserved.
+func NewWorker(db *database.Queries, client *http.Client, logger *slog.Logger, policy RetryPolicy) *Worker {
+	return &Worker{
+		db:        db,
+		client:    client,
+		logger:    logger,
+		policy:    policy,
+		BatchSize: 20,
+		now:       time.Now,
+	}
+}
+
+// Run sends due deliveries every interval until the context is done.
+func (w *Worker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := backoff.Drain(ctx, w.BatchSize, w.ProcessBatch); err != nil {
+			w.logger.Error("Error sending webhook deliveries", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessBatch claims up to BatchSize due deliveries and sends them, returning how many were claimed.
+func (w *Worker) ProcessBatch(ctx context.Context) (int, error) {
+	deliveries, err := w.db.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+		BatchSize:    int32(w.BatchSize),
+		LeaseSeconds: w.lease().Seconds(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, delivery := range deliveries {
+		if err := w.deliver(ctx, delivery); err != nil {
+			w.logger.Error("Error recording webhook delivery", "delivery_id", delivery.ID, "err", err)
+		}
+	}
+	return len(deliveries), nil
+}
+
+// lease returns how long claimed deliveries are reserved for the worker: long enough to send a full batch
+// one after another, each attempt taking up to the client timeout, plus a minute to record the outcomes.
+// No other worker picks the deliveries up meanwhile, unless this one crashed.
+func (w *Worker) lease() time.Duration {
+	return time.Duration(w.BatchSize)*w.client.Timeout + time.Minute
+}
+
+// deliver makes an attempt to send the delivery and records its outcome.
+func (w *Worker) deliver(ctx context.Context, delivery database.ClaimWebhookDeliveriesRow) error {
+	started := w.now()
+	statusCode, sendErr := w.send(ctx, delivery, started)
+	duration := w.now().Sub(started)
+
+	attempt := database.CreateWebhookDeliveryAttemptParams{
+		DeliveryID: delivery.ID,
+		StatusCode: sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0},
+		DurationMs: int32(duration.Milliseconds()),
+	}
+	if sendErr != nil {
+		attempt.Error = sql.NullString{String: sendErr.Error(), Valid: true}
+	}
+	if err := w.db.CreateWebhookDeliveryAttempt(ctx, attempt); err != nil {
+		return err
+	}
+
+	switch {
+	case sendErr == nil:
+		return w.db.SucceedWebhookDelivery(ctx, delivery.ID)
+	case int(delivery.Attempts) >= w.policy.MaxAttempts:
+		w.logger.Info("Giving up webhook delivery", "delivery_id", delivery.ID, "attempts", delivery.Attempts, "err", sendErr)
+		return w.db.FailWebhookDelivery(ctx, delivery.ID)
+	default:
+		return w.db.RetryWebhookDelivery(ctx, database.RetryWebhookDeliveryParams{
+			DelaySeconds: w.policy.delay(int(delivery.Attempts)).Seconds(),
+			ID:           delivery.ID,
+		})
+	}
+}
+
+// send posts the signed payload, returning the response status code, if any,
+// and an error unless the endpoint responded with a 2xx status.
+func (w *Worker) send(ctx context.Context, delivery database.ClaimWebhookDeliveriesRow, now time.Time) (int, error) {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(SignatureHeader, auth.SignWebhook([]byte(delivery.Secret), now, payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
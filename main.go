@@ -1,21 +1,30 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/szmktk/chirpy/internal/auth"
 	"github.com/szmktk/chirpy/internal/config"
 	"github.com/szmktk/chirpy/internal/database"
+	"github.com/szmktk/chirpy/internal/events"
 	"github.com/szmktk/chirpy/internal/server"
+	"github.com/szmktk/chirpy/internal/webhooks"
 )
 
 var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
+// shutdownTimeout bounds how long in-flight requests and background work may take after a shutdown signal.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -30,7 +39,7 @@ func main() {
 	dbQueries := database.New(db)
 
 	mux := http.NewServeMux()
-	srv, err := server.NewServer(cfg, dbQueries, logger)
+	srv, err := server.NewServer(cfg, db, logger)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -38,17 +47,72 @@ func main() {
 	mux.Handle("/app/", http.StripPrefix("/app", srv.MiddlewareMetricsInc(http.FileServer(http.Dir(cfg.FilePathRoot)))))
 	mux.HandleFunc("GET /admin/metrics", srv.Handler(srv.Metrics))
 	mux.HandleFunc("POST /admin/reset", srv.Handler(srv.Reset))
-	mux.HandleFunc("POST /api/users", srv.Handler(srv.CreateUser))
-	mux.HandleFunc("PUT /api/users", srv.AuthMiddleware(srv.Handler(srv.UpdateUser)))
-	mux.HandleFunc("POST /api/login", srv.Handler(srv.Login))
-	mux.HandleFunc("POST /api/refresh", srv.Handler(srv.Refresh))
-	mux.HandleFunc("POST /api/revoke", srv.Handler(srv.Revoke))
-	mux.HandleFunc("POST /api/chirps", srv.AuthMiddleware(srv.Handler(srv.CreateChirp)))
-	mux.HandleFunc("GET /api/chirps/{chirpID}", srv.Handler(srv.GetChirp))
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", srv.AuthMiddleware(srv.Handler(srv.DeleteChirp)))
-	mux.HandleFunc("GET /api/chirps", srv.Handler(srv.GetAllChirps))
-	mux.HandleFunc("POST /api/polka/webhooks", srv.Handler(srv.UpgradeUserWebhook))
+	mux.HandleFunc("POST /api/users", srv.Handler(srv.RateLimit(srv.CreateUser, server.LimitAuth)))
+	mux.HandleFunc("PATCH /api/users/me", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.UpdateUser, server.LimitWrites)), auth.ScopeUsersWrite))
+	mux.HandleFunc("PUT /api/users", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.UpdateUser, server.LimitWrites)), auth.ScopeUsersWrite))
+	mux.HandleFunc("GET /api/users/{username}", srv.Handler(srv.RateLimit(srv.GetUserProfile, server.LimitReads)))
+	mux.HandleFunc("POST /api/users/verify", srv.Handler(srv.RateLimit(srv.VerifyEmail, server.LimitAuth)))
+	mux.HandleFunc("POST /api/users/me/verify/resend", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.ResendVerificationEmail, server.LimitWrites, server.LimitEmail)), auth.ScopeUsersWrite))
+	mux.HandleFunc("POST /api/users/me/2fa", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.EnrollTwoFactor, server.LimitWrites)), auth.ScopeAccountManage))
+	mux.HandleFunc("POST /api/users/me/2fa/confirm", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.ConfirmTwoFactor, server.LimitWrites)), auth.ScopeAccountManage))
+	mux.HandleFunc("DELETE /api/users/me/2fa", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.DisableTwoFactor, server.LimitWrites)), auth.ScopeAccountManage))
+	mux.HandleFunc("POST /api/users/{userID}/follow", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.FollowUser, server.LimitWrites)), auth.ScopeUsersWrite))
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.UnfollowUser, server.LimitWrites)), auth.ScopeUsersWrite))
+	mux.HandleFunc("GET /api/users/{userID}/followers", srv.Handler(srv.RateLimit(srv.GetFollowers, server.LimitReads)))
+	mux.HandleFunc("GET /api/users/{userID}/following", srv.Handler(srv.RateLimit(srv.GetFollowing, server.LimitReads)))
+	mux.HandleFunc("GET /api/timeline", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.GetTimeline, server.LimitReads)), auth.ScopeChirpsRead))
+	mux.HandleFunc("POST /api/login", srv.Handler(srv.RateLimit(srv.Login, server.LimitAuth)))
+	mux.HandleFunc("POST /api/login/2fa", srv.Handler(srv.RateLimit(srv.LoginTwoFactor, server.LimitAuth)))
+	mux.HandleFunc("POST /api/refresh", srv.Handler(srv.RateLimit(srv.Refresh, server.LimitAuth)))
+	mux.HandleFunc("POST /api/revoke", srv.Handler(srv.RateLimit(srv.Revoke, server.LimitAuth)))
+	mux.HandleFunc("POST /api/password/forgot", srv.Handler(srv.RateLimit(srv.ForgotPassword, server.LimitAuth, server.LimitEmail)))
+	mux.HandleFunc("POST /api/password/reset", srv.Handler(srv.RateLimit(srv.ResetPassword, server.LimitAuth)))
+	mux.HandleFunc("POST /api/chirps", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.CreateChirp, server.LimitChirpCreate)), auth.ScopeChirpsWrite))
+	mux.HandleFunc("GET /api/chirps/search", srv.OptionalAuthMiddleware(srv.Handler(srv.RateLimit(srv.SearchChirps, server.LimitReads))))
+	mux.HandleFunc("GET /api/chirps/{chirpID}", srv.OptionalAuthMiddleware(srv.Handler(srv.RateLimit(srv.GetChirp, server.LimitReads))))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", srv.OptionalAuthMiddleware(srv.Handler(srv.RateLimit(srv.GetChirpThread, server.LimitReads))))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.LikeChirp, server.LimitWrites)), auth.ScopeChirpsWrite))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.UnlikeChirp, server.LimitWrites)), auth.ScopeChirpsWrite))
+	mux.HandleFunc("PATCH /api/chirps/{chirpID}", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.RequireFeature(srv.UpdateChirp, server.FeatureChirpEditing), server.LimitWrites)), auth.ScopeChirpsWrite))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", srv.Handler(srv.RateLimit(srv.GetChirpRevisions, server.LimitReads)))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.DeleteChirp, server.LimitWrites)), auth.ScopeChirpsWrite))
+	mux.HandleFunc("GET /api/chirps", srv.OptionalAuthMiddleware(srv.Handler(srv.RateLimit(srv.GetAllChirps, server.LimitReads))))
+	mux.HandleFunc("GET /api/notifications", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.GetNotifications, server.LimitReads)), auth.ScopeUsersRead))
+	mux.HandleFunc("POST /api/notifications/read", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.MarkNotificationsRead, server.LimitWrites)), auth.ScopeUsersWrite))
+	mux.HandleFunc("GET /api/sessions", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.GetSessions, server.LimitReads)), auth.ScopeAccountManage))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.RevokeSession, server.LimitWrites)), auth.ScopeAccountManage))
+	mux.HandleFunc("POST /api/sessions/revoke-all", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.RevokeAllSessions, server.LimitWrites)), auth.ScopeAccountManage))
+	mux.HandleFunc("POST /api/tokens", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.CreateScopedToken, server.LimitWrites)), auth.ScopeAccountManage))
+	mux.HandleFunc("POST /api/keys", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.CreateAPIKey, server.LimitWrites)), auth.ScopeAccountManage))
+	mux.HandleFunc("GET /api/keys", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.GetAPIKeys, server.LimitReads)), auth.ScopeAccountManage))
+	mux.HandleFunc("DELETE /api/keys/{keyID}", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.RevokeAPIKey, server.LimitWrites)), auth.ScopeAccountManage))
+	mux.HandleFunc("POST /api/webhooks", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.CreateWebhookEndpoint, server.LimitWrites)), auth.ScopeAccountManage))
+	mux.HandleFunc("GET /api/webhooks", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.GetWebhookEndpoints, server.LimitReads)), auth.ScopeAccountManage))
+	mux.HandleFunc("DELETE /api/webhooks/{webhookID}", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.DeleteWebhookEndpoint, server.LimitWrites)), auth.ScopeAccountManage))
+	mux.HandleFunc("GET /api/webhooks/{webhookID}/deliveries", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.GetWebhookDeliveries, server.LimitReads)), auth.ScopeAccountManage))
+	mux.HandleFunc("GET /api/webhooks/{webhookID}/deliveries/{deliveryID}", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.GetWebhookDelivery, server.LimitReads)), auth.ScopeAccountManage))
+	mux.HandleFunc("POST /api/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", srv.AuthMiddleware(srv.Handler(srv.RateLimit(srv.RedeliverWebhookDelivery, server.LimitWrites)), auth.ScopeAccountManage))
+	mux.HandleFunc("GET /api/hashtags/trending", srv.Handler(srv.RateLimit(srv.GetTrendingHashtags, server.LimitReads)))
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", srv.OptionalAuthMiddleware(srv.Handler(srv.RateLimit(srv.GetHashtagChirps, server.LimitReads))))
+	mux.HandleFunc("POST /api/polka/webhooks", srv.Handler(srv.RateLimit(srv.UpgradeUserWebhook, server.LimitWebhooks)))
 	mux.HandleFunc("GET /api/healthz", srv.Handler(srv.Health))
+	mux.HandleFunc("GET /.well-known/jwks.json", srv.Handler(srv.GetJWKS))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go srv.RunSubscriptionExpiry(ctx, cfg.SubscriptionExpiryInterval)
+	go srv.RunWebhookAuditLogPruning(ctx)
+
+	webhookQueue := webhooks.NewQueue(dbQueries)
+	dispatcher := events.NewDispatcher(dbQueries, logger, events.NewLogSink(logger), srv.HashtagSink(), srv.NotificationSink(), webhookQueue)
+	dispatcher.Retention = cfg.OutboxRetention
+	go dispatcher.Run(ctx, cfg.OutboxDispatchInterval)
+
+	webhookPolicy := webhooks.DefaultRetryPolicy
+	webhookPolicy.MaxAttempts = cfg.WebhookMaxAttempts
+	webhookClient := webhooks.NewHTTPClient(cfg.WebhookTimeout, cfg.WebhookAllowPrivateNetworks)
+	go webhooks.NewWorker(dbQueries, webhookClient, logger, webhookPolicy).Run(ctx, cfg.WebhookWorkerInterval)
 
 	var server *http.Server
 	server = &http.Server{
@@ -60,5 +124,25 @@ func main() {
 	}
 
 	logger.Info("Starting the server", "port", cfg.Port, "server_dir", cfg.FilePathRoot)
-	log.Fatal(server.ListenAndServe())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// requests in flight are finished first, then the work they left running in the background
+	logger.Info("Shutting down the server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error shutting down the server", "err", err)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error waiting for background work", "err", err)
+	}
 }
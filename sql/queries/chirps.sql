@@ -1,23 +1,111 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
 VALUES (
-  gen_random_uuid(), NOW(), NOW(), $1, $2
+  gen_random_uuid(), NOW(), NOW(), $1, $2, $3
 )
 RETURNING *;
 
 -- name: GetChirp :one
 SELECT * FROM chirps
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL;
 
--- name: GetAllChirps :many
-SELECT * FROM chirps
-ORDER BY created_at ASC;
+-- name: UpdateChirpBody :one
+WITH revision AS (
+  INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+  SELECT gen_random_uuid(), id, body, updated_at
+  FROM chirps
+  WHERE id = $1 AND deleted_at IS NULL
+)
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING *;
 
 -- name: DeleteChirp :exec
-DELETE FROM chirps
+WITH revisions AS (
+  DELETE FROM chirp_revisions
+  WHERE chirp_id = $1
+)
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
 WHERE id = $1;
 
--- name: GetAllChirpsForUser :many
+-- name: ListChirpsAscending :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListChirpsDescending :many
 SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+  SELECT parent.*, 1 AS depth
+  FROM chirps child
+  JOIN chirps parent ON parent.id = child.in_reply_to
+  WHERE child.id = sqlc.arg('chirp_id')
+  UNION ALL
+  SELECT parent.*, ancestors.depth + 1
+  FROM ancestors
+  JOIN chirps parent ON parent.id = ancestors.in_reply_to
+  WHERE ancestors.depth < sqlc.arg('max_depth')::int
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at
+FROM ancestors
+ORDER BY depth DESC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+  SELECT chirps.*, 1 AS depth
+  FROM chirps
+  WHERE chirps.in_reply_to = sqlc.arg('chirp_id')
+  UNION ALL
+  SELECT chirps.*, descendants.depth + 1
+  FROM descendants
+  JOIN chirps ON chirps.in_reply_to = descendants.id
+  WHERE descendants.depth < sqlc.arg('max_depth')::int
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at
+FROM descendants
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: CountChirpReplies :many
+-- Counts the direct replies of each chirp, leaving out deleted replies nobody replied to.
+SELECT replies.in_reply_to::uuid AS chirp_id, COUNT(*) AS reply_count
+FROM chirps replies
+WHERE replies.in_reply_to = ANY(sqlc.arg('chirp_ids')::uuid[])
+  AND (
+    replies.deleted_at IS NULL
+    OR EXISTS (SELECT 1 FROM chirps nested WHERE nested.in_reply_to = replies.id AND nested.deleted_at IS NULL)
+  )
+GROUP BY replies.in_reply_to;
+
+-- name: SearchChirps :many
+WITH matches AS (
+  SELECT chirps.*, ts_rank(to_tsvector('english', chirps.body), to_tsquery('english', sqlc.arg('query'))) AS rank
+  FROM chirps
+  WHERE chirps.deleted_at IS NULL
+    AND to_tsvector('english', chirps.body) @@ to_tsquery('english', sqlc.arg('query'))
+    AND (sqlc.narg('author_id')::uuid IS NULL OR chirps.user_id = sqlc.narg('author_id')::uuid)
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, rank
+FROM matches
+WHERE sqlc.narg('cursor_rank')::real IS NULL
+  OR (rank, created_at, id) < (sqlc.narg('cursor_rank')::real, sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
@@ -0,0 +1,27 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, user_id, email, created_at, expires_at, used_at)
+VALUES (
+  $1, $2, $3, NOW(), $4, NULL
+);
+
+-- name: InvalidateEmailVerificationTokens :exec
+UPDATE email_verification_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: VerifyEmail :one
+-- Consumes the token and marks the address it was issued for as verified,
+-- unless the user has changed their email in the meantime.
+WITH token AS (
+  UPDATE email_verification_tokens
+  SET used_at = NOW()
+  WHERE token_hash = $1
+    AND used_at IS NULL
+    AND expires_at > NOW()
+  RETURNING user_id, email
+)
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+FROM token
+WHERE users.id = token.user_id AND users.email = token.email
+RETURNING users.id;
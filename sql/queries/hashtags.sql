@@ -0,0 +1,40 @@
+-- name: TagChirp :exec
+WITH tags AS (
+  INSERT INTO hashtags (id, tag, created_at)
+  SELECT gen_random_uuid(), tag, NOW()
+  FROM unnest(sqlc.arg('tags')::text[]) AS tag
+  ON CONFLICT (tag) DO UPDATE SET tag = EXCLUDED.tag
+  RETURNING id
+)
+INSERT INTO chirp_hashtags (chirp_id, hashtag_id, created_at)
+SELECT sqlc.arg('chirp_id'), id, NOW()
+FROM tags
+ON CONFLICT (chirp_id, hashtag_id) DO NOTHING;
+
+-- name: ClearChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: ListChirpsByHashtag :many
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE hashtags.tag = sqlc.arg('tag')
+  AND chirps.deleted_at IS NULL
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: GetTrendingHashtags :many
+SELECT hashtags.tag, COUNT(*) AS chirp_count
+FROM chirp_hashtags
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+WHERE chirps.created_at >= NOW() - (sqlc.arg('window_seconds')::int * INTERVAL '1 second')
+  AND chirps.deleted_at IS NULL
+GROUP BY hashtags.tag
+ORDER BY chirp_count DESC, hashtags.tag ASC
+LIMIT sqlc.arg('row_limit');
@@ -0,0 +1,35 @@
+-- name: ReserveLoginAttempt :one
+-- Counts a login attempt as failed before its outcome is known, starting over when the previous failure happened
+-- before the window started. The failure before it is kept so that refunding the attempt can restore it.
+INSERT INTO login_attempts (key, failures, last_failure_at)
+VALUES (sqlc.arg('key'), 1, sqlc.arg('reserved_at'))
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+    WHEN login_attempts.last_failure_at < sqlc.arg('window_start') THEN 1
+    ELSE login_attempts.failures + 1
+  END,
+  previous_failure_at = CASE
+    WHEN login_attempts.last_failure_at < sqlc.arg('window_start') THEN NULL
+    ELSE login_attempts.last_failure_at
+  END,
+  last_failure_at = sqlc.arg('reserved_at')
+RETURNING *;
+
+-- name: RefundLoginAttempt :exec
+-- Takes back an attempt reserved at the given time. The last failure is only restored when no attempt
+-- was reserved after it.
+UPDATE login_attempts
+SET failures = failures - 1,
+  last_failure_at = CASE
+    WHEN last_failure_at = sqlc.arg('reserved_at') THEN COALESCE(sqlc.narg('previous_failure_at'), last_failure_at)
+    ELSE last_failure_at
+  END
+WHERE key = sqlc.arg('key') AND failures > 0;
+
+-- name: ResetLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE key = $1;
+
+-- name: DeleteStaleLoginAttempts :execrows
+DELETE FROM login_attempts
+WHERE last_failure_at < $1;
@@ -0,0 +1,41 @@
+-- name: CreateNotification :exec
+-- Notifies a user about an event, at most once per event.
+INSERT INTO notifications (id, user_id, actor_id, type, chirp_id, event_id, created_at, read_at)
+SELECT gen_random_uuid(), sqlc.arg('user_id'), sqlc.arg('actor_id'), sqlc.arg('type'), sqlc.narg('chirp_id'), sqlc.arg('event_id')::uuid, NOW(), NULL
+WHERE sqlc.arg('user_id')::uuid <> sqlc.arg('actor_id')::uuid
+ON CONFLICT (event_id, user_id, type) DO NOTHING;
+
+-- name: CreateMentionNotifications :exec
+-- Notifies the users mentioned in a chirp, at most once per event.
+INSERT INTO notifications (id, user_id, actor_id, type, chirp_id, event_id, created_at, read_at)
+SELECT gen_random_uuid(), users.id, sqlc.arg('actor_id'), 'mention', sqlc.arg('chirp_id'), sqlc.arg('event_id')::uuid, NOW(), NULL
+FROM users
+WHERE users.username = ANY(sqlc.arg('usernames')::text[])
+  AND users.id <> sqlc.arg('actor_id')::uuid
+ON CONFLICT (event_id, user_id, type) DO NOTHING;
+
+-- name: ListNotifications :many
+SELECT * FROM notifications
+WHERE user_id = sqlc.arg('user_id')
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = sqlc.arg('user_id')
+  AND id = ANY(sqlc.arg('ids')::uuid[])
+  AND read_at IS NULL;
+
+-- name: MarkAllNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
@@ -0,0 +1,35 @@
+-- name: InsertOutboxEvent :exec
+-- Records an event to be published once the surrounding transaction commits.
+INSERT INTO outbox (id, event_type, user_id, payload, created_at, next_attempt_at)
+VALUES ($1, $2, $3, $4, NOW(), NOW());
+
+-- name: ClaimOutboxEvents :many
+-- Claims due events in the order they were recorded, skipping rows claimed by other dispatchers.
+-- Claimed events are not due again until the lease expires, so events of a crashed dispatcher are retried.
+WITH due AS (
+  SELECT outbox.id FROM outbox
+  WHERE outbox.published_at IS NULL AND outbox.next_attempt_at <= NOW()
+  ORDER BY outbox.created_at, outbox.id
+  LIMIT sqlc.arg('batch_size')
+  FOR UPDATE SKIP LOCKED
+)
+UPDATE outbox
+SET attempts = outbox.attempts + 1,
+  next_attempt_at = NOW() + make_interval(secs => sqlc.arg('lease_seconds'))
+FROM due
+WHERE outbox.id = due.id
+RETURNING outbox.*;
+
+-- name: MarkOutboxEventPublished :exec
+UPDATE outbox
+SET published_at = NOW(), last_error = NULL
+WHERE id = $1;
+
+-- name: RetryOutboxEvent :exec
+UPDATE outbox
+SET next_attempt_at = NOW() + make_interval(secs => sqlc.arg('delay_seconds')), last_error = sqlc.arg('last_error')
+WHERE id = sqlc.arg('id');
+
+-- name: DeletePublishedOutboxEvents :execrows
+DELETE FROM outbox
+WHERE published_at < NOW() - make_interval(secs => sqlc.arg('retention_seconds'));
@@ -0,0 +1,24 @@
+-- name: TakeRateLimitToken :one
+-- Moves the theoretical arrival time (TAT) of a bucket one emission interval ahead. A bucket seen for
+-- the first time, or full again, starts at now. Returns no rows when the TAT would move past max_tat.
+INSERT INTO rate_limits (key, tat)
+VALUES (sqlc.arg('key'), sqlc.arg('now')::timestamp + make_interval(secs => sqlc.arg('interval_seconds')::float8))
+ON CONFLICT (key) DO UPDATE
+SET tat = GREATEST(rate_limits.tat, sqlc.arg('now')) + make_interval(secs => sqlc.arg('interval_seconds')::float8)
+WHERE GREATEST(rate_limits.tat, sqlc.arg('now')) + make_interval(secs => sqlc.arg('interval_seconds')::float8) <= sqlc.arg('max_tat')
+RETURNING tat;
+
+-- name: GetRateLimit :one
+SELECT tat FROM rate_limits
+WHERE key = $1;
+
+-- name: DeleteExpiredRateLimits :execrows
+DELETE FROM rate_limits
+WHERE tat < $1;
+
+-- name: RefundRateLimitToken :exec
+-- Moves the TAT of a bucket one emission interval back, giving back a token taken for a request
+-- that was rejected by another limit.
+UPDATE rate_limits
+SET tat = tat - make_interval(secs => sqlc.arg('interval_seconds')::float8)
+WHERE key = sqlc.arg('key');
@@ -1,15 +1,71 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (
+  token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by,
+  user_agent, ip_address, last_used_at, device_label
+)
 VALUES (
-  $1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL
+  $1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL, $3, NULL,
+  $4, $5, NOW(), $6
 )
 RETURNING *;
 
 -- name: GetRefreshToken :one
 SELECT * FROM refresh_tokens
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: RotateRefreshToken :one
+-- Revokes a valid refresh token and issues its successor within the same token family.
+-- Returns no rows when the token is unknown, expired or has already been revoked or rotated.
+WITH rotated AS (
+  UPDATE refresh_tokens
+  SET revoked_at = NOW(), updated_at = NOW(), replaced_by = sqlc.arg('new_token_hash')
+  WHERE token_hash = sqlc.arg('token_hash')
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+  RETURNING user_id, family_id, device_label
+)
+INSERT INTO refresh_tokens (
+  token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by,
+  user_agent, ip_address, last_used_at, device_label
+)
+SELECT
+  sqlc.arg('new_token_hash'), NOW(), NOW(), rotated.user_id, NOW() + INTERVAL '60 days', NULL, rotated.family_id, NULL,
+  sqlc.narg('user_agent'), sqlc.narg('ip_address'), NOW(), rotated.device_label
+FROM rotated
+RETURNING *;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokensForUser :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: ListSessions :many
+-- Lists the signed in sessions of a user. A session is a token family with a refresh token still valid.
+SELECT
+  refresh_tokens.family_id,
+  refresh_tokens.device_label,
+  refresh_tokens.user_agent,
+  refresh_tokens.ip_address,
+  refresh_tokens.last_used_at,
+  refresh_tokens.expires_at,
+  (SELECT MIN(family.created_at) FROM refresh_tokens AS family WHERE family.family_id = refresh_tokens.family_id)::timestamp AS signed_in_at
+FROM refresh_tokens
+WHERE refresh_tokens.user_id = $1
+  AND refresh_tokens.revoked_at IS NULL
+  AND refresh_tokens.expires_at > NOW()
+ORDER BY refresh_tokens.last_used_at DESC NULLS LAST;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
@@ -0,0 +1,53 @@
+-- name: UpsertSubscription :one
+-- Starts or renews the subscription of a user, returning no row when the user does not exist.
+INSERT INTO subscriptions (id, user_id, plan, status, current_period_start, current_period_end, created_at, updated_at)
+SELECT gen_random_uuid(), users.id, $2::text, 'active', $3::timestamp, $4::timestamp, NOW(), NOW()
+FROM users
+WHERE users.id = $1
+ON CONFLICT (user_id) DO UPDATE
+SET plan = EXCLUDED.plan,
+  status = 'active',
+  current_period_start = EXCLUDED.current_period_start,
+  current_period_end = EXCLUDED.current_period_end,
+  canceled_at = NULL,
+  updated_at = NOW()
+RETURNING *;
+
+-- name: GetActiveSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1 AND status <> 'expired' AND current_period_end > NOW();
+
+-- name: CancelSubscription :one
+-- Cancels the subscription at the end of the paid period.
+UPDATE subscriptions
+SET status = 'canceled', canceled_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND status <> 'expired'
+RETURNING *;
+
+-- name: MarkSubscriptionPastDue :one
+-- Flags a failed payment, the subscription stays until the end of the paid period unless renewed.
+UPDATE subscriptions
+SET status = 'past_due', updated_at = NOW()
+WHERE user_id = $1 AND status IN ('active', 'past_due')
+RETURNING *;
+
+-- name: EndSubscription :one
+-- Ends the subscription right away.
+UPDATE subscriptions
+SET status = 'expired', current_period_end = LEAST(current_period_end, NOW()), updated_at = NOW()
+WHERE user_id = $1 AND status <> 'expired'
+RETURNING *;
+
+-- name: ExpireSubscriptions :many
+-- Expires subscriptions whose paid period has ended and takes Chirpy Red away from their users.
+WITH expired AS (
+  UPDATE subscriptions
+  SET status = 'expired', updated_at = NOW()
+  WHERE status <> 'expired' AND current_period_end <= NOW()
+  RETURNING user_id, plan, current_period_end
+)
+UPDATE users
+SET is_chirpy_red = FALSE, updated_at = NOW()
+FROM expired
+WHERE users.id = expired.user_id
+RETURNING users.id, expired.plan, expired.current_period_end;
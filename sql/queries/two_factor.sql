@@ -0,0 +1,56 @@
+-- name: SetTOTPSecret :execrows
+UPDATE users
+SET totp_secret = $2, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $1 AND totp_enabled_at IS NULL;
+
+-- name: EnableTOTP :execrows
+UPDATE users
+SET totp_enabled_at = NOW(), totp_last_step = $2, updated_at = NOW()
+WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL;
+
+-- name: DisableTOTP :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UseTOTPStep :execrows
+-- Records the time step of an accepted code so that the same code cannot be used twice.
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2);
+
+-- name: CreateRecoveryCodes :exec
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at, used_at)
+SELECT gen_random_uuid(), sqlc.arg('user_id'), code_hash, NOW(), NULL
+FROM unnest(sqlc.arg('code_hashes')::text[]) AS code_hash;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CreateLoginChallenge :exec
+INSERT INTO login_challenges (token_hash, user_id, created_at, expires_at, attempts, used_at)
+VALUES (
+  $1, $2, NOW(), $3, 0, NULL
+);
+
+-- name: AttemptLoginChallenge :one
+-- Counts an attempt to answer the challenge and returns the user it was issued for,
+-- as long as the challenge is still open and has attempts left.
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1
+  AND used_at IS NULL
+  AND expires_at > NOW()
+  AND attempts < $2
+RETURNING user_id;
+
+-- name: ConsumeLoginChallenge :execrows
+UPDATE login_challenges
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL;
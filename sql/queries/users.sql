@@ -1,7 +1,7 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
 VALUES (
-  gen_random_uuid(), NOW(), NOW(), $1, $2
+  gen_random_uuid(), NOW(), NOW(), $1, $2, $3
 )
 RETURNING *;
 
@@ -13,14 +13,49 @@ DELETE FROM users;
 SELECT * FROM users
 WHERE email = $1;
 
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUserProfile :one
+SELECT
+  users.id,
+  users.created_at,
+  users.username,
+  users.display_name,
+  users.bio,
+  users.avatar_url,
+  users.is_chirpy_red,
+  (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id) AS follower_count,
+  (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id) AS following_count
+FROM users
+WHERE users.username = $1;
+
 -- name: UpdateUser :one
 UPDATE users
-SET email = $2, hashed_password = $3, updated_at = NOW()
-WHERE id = $1
+SET
+  email = COALESCE(sqlc.narg('email'), email),
+  email_verified_at = CASE
+    WHEN sqlc.narg('email')::text IS NULL OR sqlc.narg('email')::text = email THEN email_verified_at
+  END,
+  hashed_password = COALESCE(sqlc.narg('hashed_password'), hashed_password),
+  username = COALESCE(sqlc.narg('username'), username),
+  display_name = NULLIF(COALESCE(sqlc.narg('display_name'), display_name), ''),
+  bio = NULLIF(COALESCE(sqlc.narg('bio'), bio), ''),
+  avatar_url = NULLIF(COALESCE(sqlc.narg('avatar_url'), avatar_url), ''),
+  updated_at = NOW()
+WHERE id = sqlc.arg('id')
 RETURNING *;
 
--- name: UpgradeUser :one
+-- name: SyncChirpyRed :one
+-- Derives the Chirpy Red flag of a user from their subscription.
 UPDATE users
-SET is_chirpy_red = TRUE, updated_at = NOW()
+SET is_chirpy_red = EXISTS (
+    SELECT 1 FROM subscriptions
+    WHERE subscriptions.user_id = users.id
+      AND subscriptions.status <> 'expired'
+      AND subscriptions.current_period_end > NOW()
+  ),
+  updated_at = NOW()
 WHERE id = $1
-RETURNING id;
+RETURNING is_chirpy_red;
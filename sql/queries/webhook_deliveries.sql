@@ -0,0 +1,75 @@
+-- name: EnqueueWebhookDeliveries :execrows
+-- Queues a delivery of the event to every endpoint of the user subscribed to its type.
+-- Endpoints the event has already been queued for are skipped, so an event can be enqueued again.
+INSERT INTO webhook_deliveries (id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+SELECT gen_random_uuid(), webhook_endpoints.id, sqlc.arg('event_id')::uuid, sqlc.arg('event_type')::text, sqlc.arg('payload')::text, 'pending', 0, NOW(), NOW()
+FROM webhook_endpoints
+WHERE webhook_endpoints.user_id = sqlc.arg('user_id')
+  AND sqlc.arg('event_type')::text = ANY(webhook_endpoints.event_types)
+  AND NOT EXISTS (
+    SELECT 1 FROM webhook_deliveries
+    WHERE webhook_deliveries.endpoint_id = webhook_endpoints.id AND webhook_deliveries.event_id = sqlc.arg('event_id')::uuid
+  );
+
+-- name: ClaimWebhookDeliveries :many
+-- Claims due deliveries for an attempt, skipping rows claimed by other workers. Claimed deliveries
+-- are not due again until the lease expires, so deliveries of a crashed worker are retried.
+WITH due AS (
+  SELECT webhook_deliveries.id FROM webhook_deliveries
+  WHERE webhook_deliveries.status = 'pending' AND webhook_deliveries.next_attempt_at <= NOW()
+  ORDER BY webhook_deliveries.next_attempt_at
+  LIMIT sqlc.arg('batch_size')
+  FOR UPDATE SKIP LOCKED
+)
+UPDATE webhook_deliveries
+SET attempts = webhook_deliveries.attempts + 1,
+  next_attempt_at = NOW() + make_interval(secs => sqlc.arg('lease_seconds'))
+FROM due, webhook_endpoints
+WHERE webhook_deliveries.id = due.id AND webhook_endpoints.id = webhook_deliveries.endpoint_id
+RETURNING webhook_deliveries.id, webhook_deliveries.event_type, webhook_deliveries.payload, webhook_deliveries.attempts, webhook_endpoints.url, webhook_endpoints.secret;
+
+-- name: SucceedWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = 'succeeded', delivered_at = NOW()
+WHERE id = $1;
+
+-- name: RetryWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET next_attempt_at = NOW() + make_interval(secs => sqlc.arg('delay_seconds'))
+WHERE id = sqlc.arg('id');
+
+-- name: FailWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = 'failed'
+WHERE id = $1;
+
+-- name: CreateWebhookDeliveryAttempt :exec
+INSERT INTO webhook_delivery_attempts (id, delivery_id, attempted_at, status_code, error, duration_ms)
+VALUES (gen_random_uuid(), $1, NOW(), $2, $3, $4);
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = sqlc.arg('endpoint_id')
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1 AND endpoint_id = $2;
+
+-- name: ListWebhookDeliveryAttempts :many
+SELECT * FROM webhook_delivery_attempts
+WHERE delivery_id = $1
+ORDER BY attempted_at DESC;
+
+-- name: RedeliverWebhookDelivery :one
+-- Queues a new delivery of the payload of a previous one.
+INSERT INTO webhook_deliveries (id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+SELECT gen_random_uuid(), endpoint_id, event_id, event_type, payload, 'pending', 0, NOW(), NOW()
+FROM webhook_deliveries
+WHERE webhook_deliveries.id = $1 AND webhook_deliveries.endpoint_id = $2
+RETURNING *;
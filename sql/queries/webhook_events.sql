@@ -0,0 +1,15 @@
+-- name: RecordWebhookEvent :one
+-- Records a received event, returning no row when the event has been recorded before.
+INSERT INTO webhook_events (provider, event_id, event, received_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (provider, event_id) DO NOTHING
+RETURNING event_id;
+
+-- name: CreateWebhookAuditLog :exec
+INSERT INTO webhook_audit_log (id, provider, event_id, event, payload, signature_valid, outcome, status_code, received_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, NOW());
+
+-- name: DeleteWebhookAuditLog :execrows
+-- Deletes audit log entries received longer than the retention ago.
+DELETE FROM webhook_audit_log
+WHERE received_at < NOW() - make_interval(secs => sqlc.arg('retention_seconds'));
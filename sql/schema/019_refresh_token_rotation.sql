@@ -0,0 +1,32 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN token_hash TEXT,
+ADD COLUMN family_id UUID,
+ADD COLUMN replaced_by TEXT;
+
+-- Existing tokens stay valid: their hashes match what the server computes for the raw token.
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex'),
+    family_id = gen_random_uuid();
+
+ALTER TABLE refresh_tokens
+DROP COLUMN token,
+ALTER COLUMN token_hash SET NOT NULL,
+ALTER COLUMN family_id SET NOT NULL,
+ADD PRIMARY KEY (token_hash);
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+-- +goose Down
+-- Raw tokens cannot be recovered from their hashes, so every session is signed out.
+DELETE FROM refresh_tokens;
+
+DROP INDEX idx_refresh_tokens_user_id;
+DROP INDEX idx_refresh_tokens_family_id;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN token_hash,
+DROP COLUMN family_id,
+DROP COLUMN replaced_by,
+ADD COLUMN token TEXT PRIMARY KEY;
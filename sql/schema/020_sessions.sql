@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN user_agent TEXT,
+ADD COLUMN ip_address TEXT,
+ADD COLUMN last_used_at TIMESTAMP,
+ADD COLUMN device_label TEXT;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN user_agent,
+DROP COLUMN ip_address,
+DROP COLUMN last_used_at,
+DROP COLUMN device_label;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE rate_limits (
+    key TEXT PRIMARY KEY,
+    tat TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_rate_limits_tat ON rate_limits (tat);
+
+-- +goose Down
+DROP TABLE rate_limits;
@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE webhook_events (
+    provider TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event TEXT NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (provider, event_id)
+);
+
+CREATE TABLE webhook_audit_log (
+    id UUID PRIMARY KEY,
+    provider TEXT NOT NULL,
+    event_id TEXT,
+    event TEXT,
+    payload TEXT NOT NULL,
+    signature_valid BOOLEAN NOT NULL,
+    outcome TEXT NOT NULL,
+    status_code INTEGER NOT NULL,
+    received_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_webhook_audit_log_received_at ON webhook_audit_log (received_at);
+
+-- +goose Down
+DROP TABLE webhook_audit_log;
+DROP TABLE webhook_events;
@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL UNIQUE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL,
+    current_period_start TIMESTAMP NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    canceled_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT chk_subscription_status CHECK (status IN ('active', 'past_due', 'canceled', 'expired'))
+);
+
+CREATE INDEX idx_subscriptions_current_period_end ON subscriptions (current_period_end) WHERE status <> 'expired';
+
+-- users upgraded before subscriptions were tracked keep Chirpy Red until Polka renews or downgrades it;
+-- a far-future date stands in for 'infinity', which lib/pq cannot scan into time.Time
+INSERT INTO subscriptions (id, user_id, plan, status, current_period_start, current_period_end, created_at, updated_at)
+SELECT gen_random_uuid(), id, 'chirpy_red', 'active', NOW(), TIMESTAMP '9999-12-31 00:00:00', NOW(), NOW()
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
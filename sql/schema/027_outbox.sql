@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE outbox (
+    id UUID PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX idx_outbox_next_attempt_at ON outbox (next_attempt_at) WHERE published_at IS NULL;
+
+-- +goose Down
+DROP TABLE outbox;
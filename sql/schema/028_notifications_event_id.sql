@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE notifications
+ADD COLUMN event_id UUID;
+
+-- notifications created for an event are kept once, however often the event is published
+CREATE UNIQUE INDEX idx_notifications_event_id ON notifications (event_id, user_id, type);
+
+-- +goose Down
+DROP INDEX idx_notifications_event_id;
+
+ALTER TABLE notifications
+DROP COLUMN event_id;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- attempts are counted before their outcome is known, a refunded attempt restores the failure before it
+ALTER TABLE login_attempts
+ADD COLUMN previous_failure_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE login_attempts
+DROP COLUMN previous_failure_at;